@@ -0,0 +1,65 @@
+package ps
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/yaml"
+)
+
+// fileConfig holds team-wide defaults read from ~/.kube/ps.yaml (or
+// --config). Command-line options override these, which in turn
+// override the built-in defaults:
+//
+//	units: gi                 # human | ki | mi | gi | ti | bytes | quantity
+//	flags:                    # used when the flags string is omitted
+//	  pods: mcur
+//	  nodes: mcrlp
+//	excludeNamespaces:        # hidden from pods -A and namespaces
+//	  - kube-system
+//	color: always             # auto | always | never, as --color
+//	colorWarn: 80             # --color: yellow above this percent
+//	colorCrit: 90             # --color: red above this percent
+//	cost:                     # COST column priced from requests (needs r)
+//	  cpu: 20                 # per core
+//	  memory: 3               # per GiB, as is ephemeral-storage
+//	  nvidia.com/gpu: 400     # per unit of a --resource family
+type fileConfig struct {
+	Units             string             `json:"units,omitempty"`
+	Flags             map[string]string  `json:"flags,omitempty"`
+	ExcludeNamespaces []string           `json:"excludeNamespaces,omitempty"`
+	Color             string             `json:"color,omitempty"`
+	ColorWarn         float64            `json:"colorWarn,omitempty"`
+	ColorCrit         float64            `json:"colorCrit,omitempty"`
+	Cost              map[string]float64 `json:"cost,omitempty"`
+}
+
+func defaultConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kube", "ps.yaml")
+}
+
+// loadConfig reads path; a missing file is only an error when the path
+// was given explicitly.
+func loadConfig(path string, explicit bool) (fileConfig, error) {
+	var fc fileConfig
+	if path == "" {
+		return fc, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return fc, nil
+	}
+	if err != nil {
+		return fc, err
+	}
+	if err := yaml.UnmarshalStrict(data, &fc); err != nil {
+		return fc, errors.New(path + ": " + err.Error())
+	}
+	return fc, nil
+}
@@ -0,0 +1,74 @@
+package ps
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/*.golden")
+
+// TestGolden renders tables from testdata/cluster.yaml through the
+// --from-file backend and compares them with testdata/<name>.golden;
+// go test -run TestGolden -update rewrites the files. The fixture has no
+// creation times, so AGE is always -.
+func TestGolden(t *testing.T) {
+	static, err := loadStatic(filepath.Join("testdata", "cluster.yaml"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &kube{static: static}
+	u := unitCfg{mem: unitHuman, precision: -1}
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name, scope, flags string
+		render             func(*bytes.Buffer, columnCfg, rune, rune) error
+	}{
+		{"pods", "pods", "mcrl", func(w *bytes.Buffer, cfg columnCfg, fam, metric rune) error {
+			rows, err := collectPods(ctx, k, "default", true, cfg, fam, metric, false)
+			printPods(w, rows, cfg, true, fam, u)
+			return err
+		}},
+		{"pods-cpu", "pods", "cmrx", func(w *bytes.Buffer, cfg columnCfg, fam, metric rune) error {
+			rows, err := collectPods(ctx, k, "shop", false, cfg, fam, metric, false)
+			printPods(w, rows, cfg, false, fam, u)
+			return err
+		}},
+		{"nodes", "nodes", "mcrlp", func(w *bytes.Buffer, cfg columnCfg, fam, metric rune) error {
+			rows, err := collectNodes(ctx, k, cfg, fam, metric, false)
+			printNodes(w, rows, cfg, fam, u)
+			return err
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := parseFlags(tc.flags, tc.scope)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg.total, cfg.cellMax = true, 48
+			fam, metric := detectSort(tc.flags)
+
+			var buf bytes.Buffer
+			if err := tc.render(&buf, cfg, fam, metric); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join("testdata", tc.name+".golden")
+			if *update {
+				if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != string(want) {
+				t.Errorf("%s differs from %s:\n%s", tc.name, path, got)
+			}
+		})
+	}
+}
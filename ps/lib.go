@@ -0,0 +1,135 @@
+package ps
+
+import (
+	"context"
+
+	"k8s.io/client-go/kubernetes"
+	metricsclient "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+/* ---------- library entry points ---------- */
+
+// Options picks the rows of the Collect functions the way the command
+// line does; the zero value is not usable, Flags is required.
+type Options struct {
+	Flags         string // metric flags as for the scope, e.g. "mcur"; they set the sort too
+	Namespace     string // namespace to list, "default" when empty
+	AllNamespaces bool   // -A
+	LabelSelector string // -l, applied to the scope's own objects
+	FieldSelector string // --field-selector, pods and containers only
+	Reverse       bool   // -r
+}
+
+func (o Options) namespace() string {
+	if o.Namespace == "" {
+		return "default"
+	}
+	return o.Namespace
+}
+
+// setup turns the options into what the collectors take; a nil metrics
+// leaves usage null, as without metrics-server.
+func (o Options) setup(client kubernetes.Interface, metrics metricsclient.Interface,
+	scope string) (k *kube, cfg columnCfg, fam, metric rune, err error) {
+
+	if cfg, err = parseFlags(o.Flags, scope); err != nil {
+		return nil, cfg, 0, 0, err
+	}
+	cfg.labelSel, cfg.fieldSel = o.LabelSelector, o.FieldSelector
+	fam, metric = detectSort(o.Flags)
+	k = &kube{core: client, metrics: metrics, chunkSize: 500}
+	return k, cfg, fam, metric, nil
+}
+
+// CollectPods returns the rows of kubectl ps pods, sorted as the flags
+// say, in the form -o json prints them.
+func CollectPods(ctx context.Context, client kubernetes.Interface, metrics metricsclient.Interface,
+	opts Options) ([]Row, error) {
+
+	k, cfg, fam, metric, err := opts.setup(client, metrics, "pods")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := collectPods(ctx, k, opts.namespace(), opts.AllNamespaces, cfg, fam, metric, opts.Reverse)
+	if err != nil {
+		return nil, err
+	}
+	return podObjects(rows, cfg), nil
+}
+
+// CollectContainers returns the rows of kubectl ps containers.
+func CollectContainers(ctx context.Context, client kubernetes.Interface, metrics metricsclient.Interface,
+	opts Options) ([]Row, error) {
+
+	k, cfg, fam, metric, err := opts.setup(client, metrics, "containers")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := collectContainers(ctx, k, opts.namespace(), opts.AllNamespaces, cfg, fam, metric, opts.Reverse)
+	if err != nil {
+		return nil, err
+	}
+	return containerObjects(rows, cfg), nil
+}
+
+// CollectDeployments returns the rows of kubectl ps deployments.
+func CollectDeployments(ctx context.Context, client kubernetes.Interface, metrics metricsclient.Interface,
+	opts Options) ([]Row, error) {
+
+	k, cfg, fam, metric, err := opts.setup(client, metrics, "deployments")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := collectDeployments(ctx, k, opts.namespace(), opts.AllNamespaces, cfg, fam, metric, opts.Reverse)
+	if err != nil {
+		return nil, err
+	}
+	return deployObjects(rows, cfg), nil
+}
+
+// CollectNodes returns the rows of kubectl ps nodes; the namespace
+// options do not apply.
+func CollectNodes(ctx context.Context, client kubernetes.Interface, metrics metricsclient.Interface,
+	opts Options) ([]Row, error) {
+
+	k, cfg, fam, metric, err := opts.setup(client, metrics, "nodes")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := collectNodes(ctx, k, cfg, fam, metric, opts.Reverse)
+	if err != nil {
+		return nil, err
+	}
+	return nodeObjects(rows, cfg), nil
+}
+
+// CollectNamespaces returns the rows of kubectl ps namespaces, one per
+// namespace of the cluster.
+func CollectNamespaces(ctx context.Context, client kubernetes.Interface, metrics metricsclient.Interface,
+	opts Options) ([]Row, error) {
+
+	k, cfg, fam, metric, err := opts.setup(client, metrics, "namespaces")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := collectNamespaces(ctx, k, cfg, fam, metric, opts.Reverse)
+	if err != nil {
+		return nil, err
+	}
+	return nsObjects(rows, cfg), nil
+}
+
+// CollectPVCs returns the rows of kubectl ps pvc, storage under Storage.
+func CollectPVCs(ctx context.Context, client kubernetes.Interface, metrics metricsclient.Interface,
+	opts Options) ([]Row, error) {
+
+	k, cfg, fam, metric, err := opts.setup(client, metrics, "pvc")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := collectPVCs(ctx, k, opts.namespace(), opts.AllNamespaces, cfg, fam, metric, opts.Reverse)
+	if err != nil {
+		return nil, err
+	}
+	return pvcObjects(rows, cfg), nil
+}
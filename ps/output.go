@@ -0,0 +1,761 @@
+package ps
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Row is the machine-readable form of one table row. Memory and
+// ephemeral storage are in bytes and CPU in millicores (nanocores with
+// --cpu nano); metrics the cluster did not report are null rather than
+// the -1 sentinel used internally.
+type Row struct {
+	Namespace   string                       `json:"namespace,omitempty"`
+	Pod         string                       `json:"pod,omitempty"` // containers
+	Name        string                       `json:"name"`
+	Status      string                       `json:"status,omitempty"`
+	Ready       string                       `json:"ready,omitempty"` // pods, deployments
+	Node        string                       `json:"node,omitempty"`
+	Reason      string                       `json:"reason,omitempty"`
+	Scheduler   string                       `json:"scheduler,omitempty"`
+	NodeStatus  string                       `json:"nodeStatus,omitempty"`
+	Restarts    *int64                       `json:"restarts,omitempty"`
+	Running     *int64                       `json:"running,omitempty"` // namespaces --pod-counts
+	Pending     *int64                       `json:"pending,omitempty"`
+	Failed      *int64                       `json:"failed,omitempty"`
+	PodCount    *int64                       `json:"podCount,omitempty"` // nodes --pod-counts
+	NotReady    *int64                       `json:"notReady,omitempty"`
+	Nodes       *int64                       `json:"nodes,omitempty"` // deployments
+	OneNode     bool                         `json:"oneNode,omitempty"`
+	QOS         string                       `json:"qos,omitempty"`
+	Created     *time.Time                   `json:"created,omitempty"`
+	AgeSeconds  *int64                       `json:"ageSeconds,omitempty"`
+	ReadySince  *time.Time                   `json:"readySince,omitempty"`
+	LastRestart *time.Time                   `json:"lastRestart,omitempty"`
+	Memory      map[string]*int64            `json:"memory,omitempty"`
+	Storage     map[string]*int64            `json:"storage,omitempty"` // pvc
+	CPU         map[string]*int64            `json:"cpu,omitempty"`
+	Ephemeral   map[string]*int64            `json:"ephemeralStorage,omitempty"`
+	Resources   map[string]map[string]*int64 `json:"resources,omitempty"` // --resource, by name
+	Score       *float64                     `json:"score,omitempty"`     // --merge-families
+	Cost        *float64                     `json:"cost,omitempty"`      // config cost map
+	Total       bool                         `json:"total,omitempty"`
+}
+
+var metricNames = map[rune]string{
+	'r': "requests", 'l': "limits", 'u': "usage",
+	'f': "free", 't': "total", 's': "reserved", 'o': "podLimits",
+	'T': "capacity",
+}
+
+// familyObject keeps the stored metrics of one family; derived columns
+// (percent, delta) are left to the consumer.
+func familyObject(mp map[rune]int64, cfg columnCfg, enabled bool) map[string]*int64 {
+	if !enabled {
+		return nil
+	}
+	out := map[string]*int64{}
+	for _, m := range cfg.metrics {
+		if isDerived(m) {
+			continue
+		}
+		var v *int64
+		if mp[m] >= 0 {
+			x := mp[m]
+			v = &x
+		}
+		out[metricKey(m, cfg)] = v
+	}
+	return out
+}
+
+func newRow(name, status string, created time.Time, vals famMaps, cfg columnCfg) Row {
+	o := Row{
+		Name:      name,
+		Status:    status,
+		Memory:    familyObject(vals['m'], cfg, cfg.has('m')),
+		CPU:       familyObject(vals['c'], cfg, cfg.has('c')),
+		Ephemeral: familyObject(vals['e'], cfg, cfg.has('e')),
+	}
+	if cfg.storage {
+		o.Memory, o.Storage = nil, o.Memory
+	}
+	for _, f := range cfg.table[3:] {
+		if cfg.has(f.letter) {
+			if o.Resources == nil {
+				o.Resources = map[string]map[string]*int64{}
+			}
+			o.Resources[string(f.resource)] = familyObject(vals[f.letter], cfg, true)
+		}
+	}
+	if sc := scoreValue(vals); cfg.score && sc >= 0 {
+		o.Score = &sc
+	}
+	if c := costValue(vals, cfg); cfg.cost != nil && c >= 0 {
+		o.Cost = &c
+	}
+	if !created.IsZero() {
+		age := int64(cfg.age.now().Sub(created).Seconds())
+		o.Created, o.AgeSeconds = timePtr(created), &age
+	}
+	return o
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
+
+func totalObject(vals famMaps, cfg columnCfg) Row {
+	o := newRow("TOTAL", "", time.Time{}, vals, cfg)
+	o.Total = true
+	return o
+}
+
+func podObjects(rows []podRow, cfg columnCfg) []Row {
+	out := make([]Row, 0, len(rows)+1)
+	tot := cfg.table.newFamMaps(cfg.metrics)
+	for _, r := range rows {
+		o := newRow(r.name, r.status, r.created, r.vals, cfg)
+		o.Namespace, o.Ready = r.ns, r.ready
+		if cfg.showNode {
+			o.Node = r.node
+		}
+		if cfg.explain {
+			o.Reason = r.reason
+		}
+		if cfg.sched {
+			o.Scheduler = r.scheduler
+		}
+		if cfg.nodeStat {
+			o.NodeStatus = r.nodeStatus
+		}
+		if cfg.qos {
+			o.QOS = r.qos
+		}
+		if cfg.restarts && r.restarts >= 0 {
+			o.Restarts = &r.restarts
+		}
+		if cfg.ages {
+			o.ReadySince, o.LastRestart = timePtr(r.readySince), timePtr(r.lastRestart)
+		}
+		out = append(out, o)
+		accumulateTotals(tot, r.vals)
+	}
+	if cfg.total {
+		out = append(out, totalObject(tot, cfg))
+	}
+	return out
+}
+
+func containerObjects(rows []containerRow, cfg columnCfg) []Row {
+	out := make([]Row, 0, len(rows)+1)
+	tot := cfg.table.newFamMaps(cfg.metrics)
+	for _, r := range rows {
+		o := newRow(r.name, "", r.created, r.vals, cfg)
+		o.Namespace, o.Pod = r.ns, r.pod
+		if cfg.showNode {
+			o.Node = r.node
+		}
+		out = append(out, o)
+		accumulateTotals(tot, r.vals)
+	}
+	if cfg.total {
+		out = append(out, totalObject(tot, cfg))
+	}
+	return out
+}
+
+func deployObjects(rows []deployRow, cfg columnCfg) []Row {
+	out := make([]Row, 0, len(rows)+1)
+	tot := cfg.table.newFamMaps(cfg.metrics)
+	for _, r := range rows {
+		o := newRow(r.name, "", r.created, r.vals, cfg)
+		o.Namespace, o.Ready = r.ns, r.ready
+		o.Nodes, o.OneNode = &r.nodes, r.oneNode()
+		out = append(out, o)
+		accumulateTotals(tot, r.vals)
+	}
+	if cfg.total {
+		out = append(out, totalObject(tot, cfg))
+	}
+	return out
+}
+
+func nodeObjects(rows []nodeRow, cfg columnCfg) []Row {
+	out := make([]Row, 0, len(rows)+1)
+	tot := cfg.table.newFamMaps(cfg.metrics)
+	for _, r := range rows {
+		o := newRow(r.name, r.status, r.created, r.vals, cfg)
+		if cfg.podCount {
+			o.PodCount, o.NotReady = &r.podCount, &r.notReady
+		}
+		out = append(out, o)
+		accumulateTotals(tot, r.vals)
+	}
+	if cfg.total {
+		out = append(out, totalObject(tot, cfg))
+	}
+	return out
+}
+
+func pvcObjects(rows []pvcRow, cfg columnCfg) []Row {
+	out := make([]Row, 0, len(rows)+1)
+	tot := cfg.table.newFamMaps(cfg.metrics)
+	for _, r := range rows {
+		o := newRow(r.name, r.status, r.created, r.vals, cfg)
+		o.Namespace = r.ns
+		out = append(out, o)
+		accumulateTotals(tot, r.vals)
+	}
+	if cfg.total {
+		out = append(out, totalObject(tot, cfg))
+	}
+	return out
+}
+
+func nsObjects(rows []nsRow, cfg columnCfg) []Row {
+	out := make([]Row, 0, len(rows)+1)
+	tot := cfg.table.newFamMaps(cfg.metrics)
+	for _, r := range rows {
+		o := newRow(r.name, r.status, r.created, r.vals, cfg)
+		if cfg.podCount {
+			o.Running, o.Pending, o.Failed = &r.phases.running, &r.phases.pending, &r.phases.failed
+		}
+		out = append(out, o)
+		accumulateTotals(tot, r.vals)
+	}
+	if cfg.total {
+		out = append(out, totalObject(tot, cfg))
+	}
+	return out
+}
+
+// printJSON writes -o json: one array per sample, TOTAL last when -t.
+func printJSON(w io.Writer, objs []Row) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(objs)
+}
+
+// printJSONL writes -o jsonl: the objects of -o json, one per line and
+// no array around them, for log pipelines and jq -c.
+func printJSONL(w io.Writer, objs []Row) error {
+	enc := json.NewEncoder(w)
+	for _, o := range objs {
+		if err := enc.Encode(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// promKind is the object word in -o prometheus metric names and the label
+// carrying the row's name, per scope.
+var promKind = map[string]string{
+	"pods": "pod", "containers": "container", "deployments": "deployment",
+	"nodes": "node", "namespaces": "namespace", "pvc": "persistentvolumeclaim",
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// promFamily is the family part of a metric name, its unit suffix and
+// the divisor from the stored unit: cores rather than millicores, names
+// of extended resources with anything but [a-z0-9_] turned into _.
+func promFamily(f family, cfg columnCfg) (name, unit string, div float64) {
+	switch f.letter {
+	case 'm':
+		if cfg.storage {
+			return "storage", "_bytes", 1
+		}
+		return "memory", "_bytes", 1
+	case 'c':
+		return "cpu", "_cores", math.Pow10(-int(f.scale))
+	case 'e':
+		return "ephemeral_storage", "_bytes", 1
+	}
+	name = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(string(f.resource)))
+	return name, "", 1
+}
+
+// promOpts are what -o prometheus takes beyond the rows: a job label
+// for every series (--job), and with -o openmetrics the OpenMetrics text
+// format, every sample stamped with the time it was printed.
+type promOpts struct {
+	job         string
+	openMetrics bool
+}
+
+// printPrometheus writes -o prometheus, the text exposition format for
+// e.g. node_exporter's textfile collector: one gauge per scope, family
+// and stored metric, such as kubectl_ps_pod_memory_requests_bytes, with
+// the row's namespace and name as labels. Absent values and TOTAL are
+// left out.
+func printPrometheus(w io.Writer, objs []Row, scope string, cfg columnCfg, po promOpts) error {
+	kind := promKind[scope]
+	samples := map[string][]string{}
+	help, units := map[string]string{}, map[string]string{}
+	stamp := ""
+	if po.openMetrics {
+		stamp = " " + strconv.FormatFloat(float64(time.Now().UnixMilli())/1000, 'f', 3, 64)
+	}
+	for _, o := range objs {
+		if o.Total {
+			continue
+		}
+		var labels []string
+		if po.job != "" {
+			labels = append(labels, "job", po.job)
+		}
+		if o.Namespace != "" && scope != "namespaces" {
+			labels = append(labels, "namespace", o.Namespace)
+		}
+		if o.Pod != "" {
+			labels = append(labels, "pod", o.Pod)
+		}
+		labels = append(labels, kind, o.Name)
+		var lb strings.Builder
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				lb.WriteByte(',')
+			}
+			fmt.Fprintf(&lb, `%s="%s"`, labels[i], promLabelEscaper.Replace(labels[i+1]))
+		}
+
+		for _, f := range cfg.table {
+			if !cfg.has(f.letter) {
+				continue
+			}
+			famName, unit, div := promFamily(f, cfg)
+			for metric, v := range o.family(f) {
+				if v == nil {
+					continue
+				}
+				name := "kubectl_ps_" + kind + "_" + famName + "_" + metric + unit
+				help[name] = fmt.Sprintf("%s %s of each %s, as listed by kubectl-ps.",
+					strings.ReplaceAll(famName, "_", " "), metric, kind)
+				units[name] = strings.TrimPrefix(unit, "_")
+				samples[name] = append(samples[name], fmt.Sprintf("%s{%s} %s%s",
+					name, lb.String(), strconv.FormatFloat(float64(*v)/div, 'f', -1, 64), stamp))
+			}
+		}
+	}
+
+	names := make([]string, 0, len(samples))
+	for n := range samples {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	bw := bufio.NewWriter(w)
+	for _, n := range names {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s gauge\n", n, help[n], n)
+		if po.openMetrics && units[n] != "" {
+			fmt.Fprintf(bw, "# UNIT %s %s\n", n, units[n])
+		}
+		for _, s := range samples[n] {
+			fmt.Fprintln(bw, s)
+		}
+	}
+	if po.openMetrics {
+		fmt.Fprintln(bw, "# EOF")
+	}
+	return bw.Flush()
+}
+
+// formattedMetric is one -o yaml value: the raw number and the same
+// value rendered in the selected units.
+type formattedMetric struct {
+	Value     *int64 `json:"value"`
+	Formatted string `json:"formatted"`
+}
+
+// formattedObject replaces the metric maps of the embedded Row.
+type formattedObject struct {
+	Row
+	Memory    map[string]formattedMetric            `json:"memory,omitempty"`
+	Storage   map[string]formattedMetric            `json:"storage,omitempty"`
+	CPU       map[string]formattedMetric            `json:"cpu,omitempty"`
+	Ephemeral map[string]formattedMetric            `json:"ephemeralStorage,omitempty"`
+	Resources map[string]map[string]formattedMetric `json:"resources,omitempty"`
+}
+
+func formatFamily(mp map[string]*int64, f func(int64, unitCfg) string, u unitCfg) map[string]formattedMetric {
+	if mp == nil {
+		return nil
+	}
+	out := make(map[string]formattedMetric, len(mp))
+	for name, v := range mp {
+		fm := formattedMetric{Value: v, Formatted: "-"}
+		if v != nil {
+			fm.Formatted = f(*v, u)
+		}
+		out[name] = fm
+	}
+	return out
+}
+
+// printYAML writes -o yaml, one document per sample.
+func printYAML(w io.Writer, objs []Row, u unitCfg) error {
+	out := make([]formattedObject, 0, len(objs))
+	for _, o := range objs {
+		fo := formattedObject{
+			Row:       o,
+			Memory:    formatFamily(o.Memory, memFmt, u),
+			Storage:   formatFamily(o.Storage, memFmt, u),
+			Ephemeral: formatFamily(o.Ephemeral, memFmt, u),
+			CPU:       formatFamily(o.CPU, cpuFmt, u),
+		}
+		for name, mp := range o.Resources {
+			if fo.Resources == nil {
+				fo.Resources = map[string]map[string]formattedMetric{}
+			}
+			fo.Resources[name] = formatFamily(mp, countFmt, u)
+		}
+		out = append(out, fo)
+	}
+	data, err := yaml.Marshal(out)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(w, "---\n", string(data))
+	return err
+}
+
+// csvLine is one -o csv record before the metric cells are rendered:
+// lead holds the text columns before the metrics, tail those after AGE.
+type csvLine struct {
+	lead, tail []string
+	vals       famMaps
+	created    time.Time
+}
+
+func podCSV(rows []podRow, cfg columnCfg, all bool) (lead, tail []string, lines []csvLine) {
+	lead = []string{"NAME", "READY", "STATUS"}
+	if all {
+		lead = append([]string{"NAMESPACE"}, lead...)
+	}
+	info := podInfoColumns(cfg)
+	for _, c := range info {
+		lead = append(lead, c.header)
+	}
+	if cfg.ages {
+		tail = []string{"CREATED", "READY-SINCE", "LAST-RESTART"}
+	}
+	for _, r := range rows {
+		l := csvLine{lead: []string{r.name, r.ready, r.status}, vals: r.vals, created: r.since(cfg)}
+		if all {
+			l.lead = append([]string{r.ns}, l.lead...)
+		}
+		for _, c := range info {
+			l.lead = append(l.lead, c.value(r))
+		}
+		if cfg.ages {
+			l.tail = []string{rfc3339(r.created), rfc3339(r.readySince), rfc3339(r.lastRestart)}
+		}
+		lines = append(lines, l)
+	}
+	return lead, tail, lines
+}
+
+func containerCSV(rows []containerRow, cfg columnCfg, all bool) (lead, tail []string, lines []csvLine) {
+	lead = []string{"POD", "CONTAINER"}
+	if all {
+		lead = append([]string{"NAMESPACE"}, lead...)
+	}
+	if cfg.showNode {
+		lead = append(lead, "NODE")
+	}
+	for _, r := range rows {
+		l := csvLine{lead: []string{r.pod, r.name}, vals: r.vals, created: r.created}
+		if all {
+			l.lead = append([]string{r.ns}, l.lead...)
+		}
+		if cfg.showNode {
+			l.lead = append(l.lead, r.node)
+		}
+		lines = append(lines, l)
+	}
+	return lead, nil, lines
+}
+
+func deployCSV(rows []deployRow, all bool) (lead, tail []string, lines []csvLine) {
+	lead = []string{"NAME", "READY", "NODES"}
+	if all {
+		lead = append([]string{"NAMESPACE"}, lead...)
+	}
+	for _, r := range rows {
+		l := csvLine{lead: []string{r.name, r.ready, r.nodesCell()}, vals: r.vals, created: r.created}
+		if all {
+			l.lead = append([]string{r.ns}, l.lead...)
+		}
+		lines = append(lines, l)
+	}
+	return lead, nil, lines
+}
+
+func pvcCSV(rows []pvcRow, all bool) (lead, tail []string, lines []csvLine) {
+	lead = []string{"NAME", "STATUS"}
+	if all {
+		lead = append([]string{"NAMESPACE"}, lead...)
+	}
+	for _, r := range rows {
+		l := csvLine{lead: []string{r.name, r.status}, vals: r.vals, created: r.created}
+		if all {
+			l.lead = append([]string{r.ns}, l.lead...)
+		}
+		lines = append(lines, l)
+	}
+	return lead, nil, lines
+}
+
+func nodeCSV(rows []nodeRow) (lead, tail []string, lines []csvLine) {
+	for _, r := range rows {
+		lines = append(lines, csvLine{lead: []string{r.name, r.status}, vals: r.vals, created: r.created})
+	}
+	return []string{"NAME", "STATUS"}, nil, lines
+}
+
+func nsCSV(rows []nsRow) (lead, tail []string, lines []csvLine) {
+	for _, r := range rows {
+		lines = append(lines, csvLine{lead: []string{r.name, r.status}, vals: r.vals, created: r.created})
+	}
+	return []string{"NAME", "STATUS"}, nil, lines
+}
+
+func rfc3339(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// cells splits one tab-separated fragment written by writeHeaders or
+// writeRowMetrics; "-" (absent) becomes an empty cell.
+func cells(s string) []string {
+	if s == "" {
+		return nil
+	}
+	out := strings.Split(strings.TrimSuffix(s, "\t"), "\t")
+	for i, c := range out {
+		if c == "-" {
+			out[i] = ""
+		}
+	}
+	return out
+}
+
+// printCSV writes -o csv with the metric columns in table order, AGE as
+// whole seconds followed by the human form, and TOTAL last when -t.
+func printCSV(w io.Writer, lead, tail []string, lines []csvLine, cfg columnCfg, fam rune, u unitCfg) error {
+	cw := csv.NewWriter(w)
+	var b strings.Builder
+	writeHeaders(&b, cfg, fam)
+	header := append(append(lead[:len(lead):len(lead)], cells(b.String())...), "AGE_SECONDS", "AGE")
+	if err := cw.Write(append(header, tail...)); err != nil {
+		return err
+	}
+
+	record := func(l csvLine) []string {
+		b.Reset()
+		writeRowMetrics(&b, l.vals, cfg, fam, u)
+		rec := append(l.lead[:len(l.lead):len(l.lead)], cells(b.String())...)
+		if l.created.IsZero() {
+			rec = append(rec, "", "")
+		} else {
+			secs := int64(cfg.age.now().Sub(l.created).Seconds())
+			rec = append(rec, strconv.FormatInt(secs, 10), ageFmt(l.created, cfg.age))
+		}
+		return append(rec, l.tail...)
+	}
+
+	sums := cfg.table.newFamMaps(cfg.metrics)
+	for _, l := range lines {
+		if err := cw.Write(record(l)); err != nil {
+			return err
+		}
+		accumulateTotals(sums, l.vals)
+	}
+	if cfg.total {
+		if cfg.scope == "nodes" {
+			allocTotals(sums)
+		}
+		tot := csvLine{lead: make([]string, len(lead)), tail: make([]string, len(tail)), vals: sums}
+		tot.lead[0] = "TOTAL"
+		if err := cw.Write(record(tot)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// customColumn is one HEADER:.path entry of -o custom-columns.
+type customColumn struct {
+	header string
+	value  func(o Row, u unitCfg, age ageOpts) string
+}
+
+// parseCustomColumns accepts kubectl's custom-columns syntax. Metric paths
+// take a family (mem/memory, cpu) and a metric letter or name, and must
+// refer to metrics requested in the flags string.
+func parseCustomColumns(spec string, cfg columnCfg) []customColumn {
+	var cols []customColumn
+	for _, part := range strings.Split(spec, ",") {
+		header, path, ok := strings.Cut(part, ":")
+		if !ok || header == "" || path == "" {
+			usage("custom-columns: expected HEADER:.path, got " + part)
+		}
+		cols = append(cols, customColumn{header: header, value: resolvePath(path, cfg)})
+	}
+	return cols
+}
+
+func resolvePath(path string, cfg columnCfg) func(Row, unitCfg, ageOpts) string {
+	str := func(f func(Row) string) func(Row, unitCfg, ageOpts) string {
+		return func(o Row, _ unitCfg, _ ageOpts) string { return orDash(f(o)) }
+	}
+	switch strings.TrimPrefix(path, ".") {
+	case "name":
+		return str(func(o Row) string { return o.Name })
+	case "namespace":
+		return str(func(o Row) string { return o.Namespace })
+	case "pod":
+		return str(func(o Row) string { return o.Pod })
+	case "status":
+		return str(func(o Row) string { return o.Status })
+	case "ready":
+		return str(func(o Row) string { return o.Ready })
+	case "qos":
+		return str(func(o Row) string { return o.QOS })
+	case "node":
+		return str(func(o Row) string { return o.Node })
+	case "reason":
+		return str(func(o Row) string { return o.Reason })
+	case "scheduler":
+		return str(func(o Row) string { return o.Scheduler })
+	case "created":
+		return str(func(o Row) string {
+			if o.Created == nil {
+				return ""
+			}
+			return o.Created.Format(time.RFC3339)
+		})
+	case "age":
+		return func(o Row, _ unitCfg, age ageOpts) string {
+			if o.Created == nil {
+				return "-"
+			}
+			return ageFmt(*o.Created, age)
+		}
+	}
+
+	// the metric follows the last dot: resource names have dots too
+	p := strings.TrimPrefix(path, ".")
+	i := strings.LastIndex(p, ".")
+	ok := i >= 0
+	famName, metricName := p, ""
+	if ok {
+		famName, metricName = p[:i], p[i+1:]
+	}
+	fam := cfg.table.byName(famName)
+	metric := metricLetter(metricName)
+	if !ok || fam == 0 || metric == 0 {
+		usage("custom-columns: unknown path " + path)
+	}
+	if !containsRune(cfg.metrics, metric) || !cfg.has(fam) {
+		usage("custom-columns: " + path + " is not in the flags string")
+	}
+	f := cfg.table.of(fam)
+	return func(o Row, u unitCfg, _ ageOpts) string {
+		v := o.family(f)[metricKey(metric, cfg)]
+		if v == nil {
+			return "-"
+		}
+		return f.format(*v, u)
+	}
+}
+
+// family is the metric map of family f in o.
+func (o Row) family(f family) map[string]*int64 {
+	switch {
+	case f.letter == 'c':
+		return o.CPU
+	case f.letter == 'e':
+		return o.Ephemeral
+	case f.letter != 'm':
+		return o.Resources[string(f.resource)]
+	case o.Storage != nil:
+		return o.Storage
+	}
+	return o.Memory
+}
+
+// metricKey is the exported name of a stored metric: the -o json key and
+// the metric part of -o prometheus names. l on nodes is allocatable, not
+// limits.
+func metricKey(m rune, cfg columnCfg) string {
+	if m == 'l' && cfg.scope == "nodes" {
+		return "allocatable"
+	}
+	return metricNames[m]
+}
+
+// metricLetter maps a stored metric letter or its name to the letter.
+func metricLetter(s string) rune {
+	if s == "allocatable" {
+		return 'l'
+	}
+	for r, name := range metricNames {
+		if s == name || s == string(r) {
+			return r
+		}
+	}
+	return 0
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func printCustomColumns(w io.Writer, objs []Row, cols []customColumn, cfg columnCfg, u unitCfg) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	hw := headerWriter(tw, cfg)
+	for i, c := range cols {
+		fmt.Fprint(hw, c.header, sep(i, len(cols)))
+	}
+	for _, o := range objs {
+		for i, c := range cols {
+			fmt.Fprint(tw, c.value(o, u, cfg.age), sep(i, len(cols)))
+		}
+	}
+	tw.Flush()
+}
+
+func sep(i, n int) string {
+	if i == n-1 {
+		return "\n"
+	}
+	return "\t"
+}
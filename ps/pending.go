@@ -0,0 +1,91 @@
+package ps
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// pendingInfo is the extra cluster state needed to tell why a pod is
+// stuck in Pending; it is only fetched for --explain.
+type pendingInfo struct {
+	unboundPVC map[string]bool // ns/claim of claims not yet Bound
+	mountFail  map[string]bool // ns/pod with FailedMount/FailedAttachVolume events
+}
+
+func fetchPendingInfo(ctx context.Context, k *kube, ns string, pods []corev1.Pod) pendingInfo {
+	pi := pendingInfo{unboundPVC: map[string]bool{}, mountFail: map[string]bool{}}
+	anyPending := false
+	for i := range pods {
+		if pods[i].Status.Phase == corev1.PodPending {
+			anyPending = true
+			break
+		}
+	}
+	if !anyPending {
+		return pi
+	}
+
+	if pvcs, err := k.listPVCs(ctx, ns, metav1.ListOptions{}); err == nil {
+		for _, c := range pvcs.Items {
+			if c.Status.Phase != corev1.ClaimBound {
+				pi.unboundPVC[key(c.Namespace, c.Name)] = true
+			}
+		}
+	} else {
+		log.Printf("listing persistentvolumeclaims: %v", err)
+	}
+	if evs, err := k.listEvents(ctx, ns, "type=Warning,involvedObject.kind=Pod"); err == nil {
+		for _, e := range evs.Items {
+			if e.Reason == "FailedMount" || e.Reason == "FailedAttachVolume" {
+				pi.mountFail[key(e.InvolvedObject.Namespace, e.InvolvedObject.Name)] = true
+			}
+		}
+	} else {
+		log.Printf("listing events: %v", err)
+	}
+	return pi
+}
+
+// classify explains a Pending pod: VolumeBinding when a claim it uses is
+// unbound, Scheduling when the scheduler has not placed it, VolumeMount
+// when the kubelet cannot attach/mount, otherwise the first container
+// waiting reason. Pods in other phases get "-".
+func (pi pendingInfo) classify(p *corev1.Pod) string {
+	if p.Status.Phase != corev1.PodPending {
+		return "-"
+	}
+	for _, v := range p.Spec.Volumes {
+		if v.PersistentVolumeClaim != nil &&
+			pi.unboundPVC[key(p.Namespace, v.PersistentVolumeClaim.ClaimName)] {
+			return "VolumeBinding"
+		}
+	}
+	for _, c := range p.Status.Conditions {
+		if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionFalse {
+			if strings.Contains(strings.ToLower(c.Message), "persistentvolumeclaim") {
+				return "VolumeBinding"
+			}
+			return "Scheduling"
+		}
+	}
+	if p.Spec.NodeName == "" {
+		return "Scheduling"
+	}
+	if pi.mountFail[key(p.Namespace, p.Name)] {
+		return "VolumeMount"
+	}
+	for _, statuses := range [][]corev1.ContainerStatus{
+		p.Status.InitContainerStatuses, p.Status.ContainerStatuses,
+	} {
+		for _, cs := range statuses {
+			if cs.State.Waiting != nil && cs.State.Waiting.Reason != "" {
+				return cs.State.Waiting.Reason
+			}
+		}
+	}
+	return "Pending"
+}
@@ -0,0 +1,4376 @@
+// Package ps builds the resource tables of kubectl-ps. Main is the
+// plugin's command line; CollectPods and its siblings in lib.go return
+// the same rows to other programs.
+package ps
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metricsclient "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+/* ---------- configuration ---------- */
+
+type columnCfg struct {
+	fams     []rune  // enabled families (m, c, e)
+	metrics  []rune  // order for headers and rows
+	showNode bool    // pods
+	restarts bool    // pods: RESTARTS column (x)
+	qos      bool    // pods: QOS column (q)
+	total    bool    // TOTAL row
+	age      ageOpts // AGE column unit and --as-of
+	ages     bool    // pods: CREATED/READY-SINCE/LAST-RESTART instead of AGE
+	ageStart bool    // pods: AGE from Status.StartTime (--age-from start)
+	groupNS  bool    // pods -A: rows by namespace, each with a subtotal
+	collapse bool    // pods: one row per controller (--collapse)
+	explain  bool    // pods: REASON column for Pending pods
+	sched    bool    // pods: SCHEDULER column
+	topPods  int     // nodes: list this many pods under each node
+	podCount bool    // pod counts: namespaces by phase, nodes POD_COUNT and NOTREADY
+	wideStat bool    // pods: kubectl-style STATUS instead of the phase
+	nodeStat bool    // pods: NODE-STATUS column
+	orphans  bool    // pods on nodes missing from the node list
+	score    bool    // SCORE column, max of mem and cpu usage/requests
+	missing  bool    // keep only rows whose usage did not come back
+	sysCont  bool    // count pause containers in usage
+	allConts bool    // --all-containers: sum init and ephemeral containers too
+	noHeader bool    // --no-headers
+	wide     bool    // --wide: pods add POD-IP, NODE, IMAGES; nodes INTERNAL-IP, ROLES
+	cellMax  int     // tables: NAME, NODE and IMAGES cut to this, 0 = --no-trunc
+	storage  bool    // pvc: the m family holds storage, not memory
+	scope    string  // the scope the flags were read for
+	color    bool    // --color: percent and free cells by utilisation, bad node status
+	failOver float64 // --fail-over: exit 2 when a row's p or P exceeds it
+
+	// --color thresholds in percent, from the config file
+	warnPct, critPct float64
+
+	// COST column: the config file's prices by resource name
+	cost map[string]float64
+
+	// the families of this run, see famSet
+	table famSet
+
+	// --min/--max on the sort column, in bytes or millicores
+	bounded    bool
+	minV, maxV float64
+
+	excludeNS   map[string]bool // from the config file; pods -A and namespaces
+	schedFilter string          // pods: only this scheduler
+	ownerKind   string          // pods: only this controller kind, or none
+	labelSel    string          // -l, applied to the scope's own objects
+	fieldSel    string          // pods: --field-selector
+	nodeName    string          // pods: --node
+
+	// display order, set by --column-order: columns holds positions in
+	// metrics, nil meaning flag order; famOrder nil puts the sort family
+	// first
+	columns  []int
+	famOrder []rune
+}
+
+// order is the positions of metrics in the order headers and cells are
+// printed. Percent operands, sort keys and --fail-over read metrics
+// itself, so reordering never changes what a column holds.
+func (c columnCfg) order() []int {
+	if c.columns != nil {
+		return c.columns
+	}
+	idx := make([]int, len(c.metrics))
+	for i := range idx {
+		idx[i] = i
+	}
+	return idx
+}
+
+// cols is the metric letters in display order.
+func (c columnCfg) cols() []rune {
+	var out []rune
+	for _, i := range c.order() {
+		out = append(out, c.metrics[i])
+	}
+	return out
+}
+
+// quotaView is namespaces with t: l, u and t come from the
+// ResourceQuotas instead of the pods.
+func (c columnCfg) quotaView() bool {
+	return c.scope == "namespaces" && containsRune(c.metrics, 't')
+}
+
+// has reports whether family f is in the flags string.
+func (c columnCfg) has(f rune) bool { return containsRune(c.fams, f) }
+
+// families lists the enabled families in render order: the sort family
+// first, then the rest in table order.
+func (c columnCfg) families(sortFam rune) []rune {
+	order := c.famOrder
+	if order == nil {
+		order = []rune{sortFam}
+		for _, f := range c.table {
+			if f.letter != sortFam {
+				order = append(order, f.letter)
+			}
+		}
+	}
+	var out []rune
+	for _, f := range order {
+		if c.has(f) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// scopeLetters is the single source of truth for which flag letters a
+// scope accepts:
+//
+//	letter       pods             nodes                namespaces
+//	m c e        families         families             families
+//	r            pod requests     sum of pod requests  sum of pod requests
+//	l            pod limits       allocatable          sum of pod limits*
+//	u            pod usage        node usage           sum of pod usage*
+//	p d          derived          derived              derived
+//	b            limits/requests  -                    limits/requests
+//	f            -                allocatable-derived  -
+//	t            -                allocatable-derived  quota hard requests
+//	s            -                capacity-allocatable -
+//	o            -                sum of pod limits    -
+//	T            -                capacity             -
+//	n            node column      -                    -
+//	x            RESTARTS column  -                    -
+//	q            QOS column       -                    -
+//	P            % of node alloc. -                    -
+//
+// e is ephemeral storage, which metrics-server does not report, so its
+// u, d and f stay empty. containers takes the pods letters but e, read
+// per container instead of per pod; deployments takes the namespaces
+// letters but e, summed over owned pods. pvc has only the m family, read
+// as storage: r is the claim's request, l and t its bound capacity. b is
+// meaningless on nodes because l is allocatable there, and f needs an
+// allocatable figure only nodes have. *With t a namespace row reads its
+// ResourceQuotas instead (quotaView): l is the hard limits.<resource>, u
+// what the quota counts as used. The all scope prints the three tables
+// and so takes only the letters they share.
+var scopeLetters = map[string]string{
+	"pods":        "mcerlupdbnxqP",
+	"containers":  "mcrlupdbn",
+	"deployments": "mcrlupdb",
+	"nodes":       "mcerlupdftsoTP",
+	"namespaces":  "mcerlupdbt",
+	"pvc":         "mrltpb",
+	"all":         "mcerlupd",
+}
+
+// sort keys used in place of a metric letter: scoreKey by
+// --merge-families, ageKey by --sort-by-age, restartKey when x comes
+// before the first metric letter, nameKey and statusKey by --sort-by
+// (alphabetical, -r reverses)
+const (
+	scoreKey   = '*'
+	ageKey     = '@'
+	restartKey = 'x'
+	nameKey    = '$'
+	statusKey  = '='
+)
+
+func isMetric(ch rune) bool   { return strings.ContainsRune("rlupftdbsoTP", ch) }
+func isNodeOnly(ch rune) bool { return ch == 'f' || ch == 't' || ch == 'T' }
+func isDerived(ch rune) bool  { return strings.ContainsRune("pdbP", ch) }
+
+// family is one resource whose requests, limits and allocatable get a
+// group of columns.
+type family struct {
+	letter rune
+	prefix string   // header prefix
+	names  []string // -o json/yaml key, then aliases for --sort-by
+
+	resource corev1.ResourceName
+	scale    resource.Scale // stored unit: milli (or nano) for cpu, else whole units
+	usage    bool           // metrics-server reports it
+	format   func(int64, unitCfg) string
+}
+
+// famSet is the families of one run: famTable, plus the --resource ones
+// and cpu in nanocores with --cpu nano. It lives in columnCfg and is
+// never changed in place, so runs with different options do not mix.
+type famSet []family
+
+// famTable is the built-in families every run starts from.
+var famTable = famSet{
+	{'m', "MEM_", []string{"memory", "mem", "storage"}, corev1.ResourceMemory, 0, true, memFmt},
+	{'c', "CPU_", []string{"cpu"}, corev1.ResourceCPU, resource.Milli, true, cpuFmt},
+	{'e', "EPH_", []string{"ephemeralStorage", "eph", "ephemeral", "ephemeral-storage"},
+		corev1.ResourceEphemeralStorage, 0, false, memFmt},
+}
+
+// withResource adds a family for an extended resource such as
+// nvidia.com/gpu, headed by its upper-cased last path segment and keyed by
+// a digit since it has no flag letter. Such resources are counted as
+// integers and have no usage.
+func (t famSet) withResource(name string) (famSet, rune) {
+	for _, f := range t {
+		if string(f.resource) == name {
+			usage("--resource " + name + " is already a family (m, c, e)")
+		}
+	}
+	letter := '1' + rune(len(t)-3) // after m, c and e
+	if letter > '9' {
+		usage("--resource: at most 9 extended resources")
+	}
+	_, short, _ := strings.Cut(name, "/")
+	if short == "" {
+		short = name
+	}
+	return append(slices.Clip(t), family{letter, strings.ToUpper(short) + "_", []string{name},
+		corev1.ResourceName(name), 0, false, countFmt}), letter
+}
+
+func (t famSet) of(f rune) family {
+	for _, x := range t {
+		if x.letter == f {
+			return x
+		}
+	}
+	panic("unknown family " + string(f))
+}
+
+// byName is the family a --sort-by or custom-columns path names, 0 for
+// none.
+func (t famSet) byName(s string) rune {
+	for _, f := range t {
+		if slices.Contains(f.names, s) {
+			return f.letter
+		}
+	}
+	return 0
+}
+
+// prices keys the config cost map by resource name, so an alias such as
+// mem or eph prices the family like memory does; extended resources keep
+// their name and only count once --resource adds them.
+func (t famSet) prices(cost map[string]float64) (map[string]float64, error) {
+	out := make(map[string]float64, len(cost))
+	for name, price := range cost {
+		key := name
+		if f := t.byName(name); f != 0 {
+			key = string(t.of(f).resource)
+		} else if !strings.Contains(name, "/") {
+			return nil, errors.New("unknown resource " + name)
+		}
+		if _, ok := out[key]; ok {
+			return nil, errors.New(key + " priced twice")
+		}
+		out[key] = price
+	}
+	return out, nil
+}
+
+func (t famSet) has(ch rune) bool {
+	for _, f := range t {
+		if f.letter == ch {
+			return true
+		}
+	}
+	return false
+}
+
+// quantityValue reads q in the unit family f stores: millicores (or
+// nanocores) for cpu, bytes (or a plain count) otherwise.
+func (f family) quantityValue(q resource.Quantity) int64 {
+	return q.ScaledValue(f.scale)
+}
+
+// cpuUsage reads a metrics-server CPU figure, given in nanocores, in the
+// unit cpu is stored in.
+func (t famSet) cpuUsage(q *resource.Quantity) int64 { return t.of('c').quantityValue(*q) }
+
+// withNanocores keeps cpu in nanocores for --cpu nano, so idle pods do
+// not round up to 1m and sorting sees the finer value.
+func (t famSet) withNanocores() famSet {
+	out := slices.Clone(t)
+	for i := range out {
+		if out[i].letter == 'c' {
+			out[i].scale = resource.Nano
+		}
+	}
+	return out
+}
+
+// listValue is the family's entry of a resource list, -1 when absent.
+func (f family) listValue(rl corev1.ResourceList) int64 {
+	if q, ok := rl[f.resource]; ok {
+		return f.quantityValue(q)
+	}
+	return -1
+}
+
+// allocKey holds the allocatable P divides by in a row's family maps:
+// the pod's node's, or a node's own; it is never printed or summed.
+const allocKey = '#'
+
+// options that consume the following token as their value
+var valueOpts = map[string]bool{
+	"-n":                     true,
+	"--timeout":              true,
+	"--api-timeout-per-call": true,
+	"--format-age":           true,
+	"--column-order":         true,
+	"--interval":             true,
+	"--watch-to-file":        true,
+	"-o":                     true,
+	"--config":               true,
+	"--as-of":                true,
+	"--scheduler":            true,
+	"--top-pods-per-node":    true,
+	"--min":                  true,
+	"-l":                     true,
+	"--context":              true,
+	"--sort-by":              true,
+	"--node":                 true,
+	"--resource":             true,
+	"--color":                true,
+	"--fail-over":            true,
+	"--kubeconfig":           true,
+	"--field-selector":       true,
+	"--max":                  true,
+	"--chunk-size":           true,
+	"--request-timeout":      true,
+	"--age-from":             true,
+	"--precision":            true,
+	"--cpu":                  true,
+	"--cpu-unit":             true,
+	"--output-file":          true,
+	"--owner":                true,
+	"--from-file":            true,
+	"--job":                  true,
+}
+
+/* ---------- entry point ---------- */
+
+// Main runs the plugin on os.Args; kubectl ps version is answered by
+// the command before it gets here.
+func Main() {
+	args := os.Args[1:]
+	if len(args) == 0 {
+		usage("missing scope")
+	}
+
+	/* -------- scope, <flags> token & options -------- */
+	scopeArg, flagsStr, opts, err := splitArgs(args)
+	if err != nil {
+		usage(err.Error())
+	}
+	if scopeArg == "" {
+		if slices.Contains(opts, "--help") {
+			usage("")
+		}
+		usage("missing scope")
+	}
+
+	/* -------- config file -------- */
+	cfgPath, explicit := defaultConfigPath(), false
+	for i := 0; i < len(opts); i++ {
+		if opts[i] == "--config" {
+			cfgPath, explicit = opts[i+1], true
+		}
+		if valueOpts[opts[i]] {
+			i++
+		}
+	}
+	fileCfg, err := loadConfig(cfgPath, explicit)
+	if err != nil {
+		usage("config: " + err.Error())
+	}
+
+	/* -------- parse scope / flags -------- */
+	scope := parseScope(scopeArg)
+	if flagsStr == "" {
+		flagsStr = fileCfg.Flags[scope]
+	}
+	if flagsStr == "" && scope == "all" {
+		flagsStr = "mcu"
+	}
+	if flagsStr == "" {
+		usage("missing metric flags string")
+	}
+	cfg, err := parseFlags(flagsStr, scope)
+	if err != nil {
+		usage(err.Error())
+	}
+	famOrder, metricPrimary := detectSort(flagsStr)
+	// --resource families exist before --sort-by or -o custom-columns
+	// name them, wherever they appear
+	for i := 0; i < len(opts); i++ {
+		if opts[i] == "--resource" {
+			if scope == "pvc" {
+				usage("--resource not valid for pvc")
+			}
+			var letter rune
+			cfg.table, letter = cfg.table.withResource(opts[i+1])
+			cfg.fams = append(cfg.fams, letter)
+		}
+		if valueOpts[opts[i]] {
+			i++
+		}
+	}
+	// cost is priced from requests, and pvc storage has no price;
+	// extended resources only count once --resource adds them
+	if len(fileCfg.Cost) > 0 && containsRune(cfg.metrics, 'r') && !cfg.storage {
+		if cfg.cost, err = cfg.table.prices(fileCfg.Cost); err != nil {
+			usage("config: cost: " + err.Error())
+		}
+	}
+	if len(fileCfg.ExcludeNamespaces) > 0 {
+		cfg.excludeNS = map[string]bool{}
+		for _, ns := range fileCfg.ExcludeNamespaces {
+			cfg.excludeNS[ns] = true
+		}
+	}
+
+	/* -------- option variables -------- */
+	allNS, reverse := false, false
+	units := unitCfg{mem: unitHuman, precision: -1}
+	if fileCfg.Units != "" {
+		units.mem = parseUnits(fileCfg.Units)
+	}
+	cfg.warnPct, cfg.critPct = 80, 90
+	cfg.cellMax = 48
+	if fileCfg.ColorWarn > 0 {
+		cfg.warnPct = fileCfg.ColorWarn
+	}
+	if fileCfg.ColorCrit > 0 {
+		cfg.critPct = fileCfg.ColorCrit
+	}
+	colorMode := "auto"
+	if fileCfg.Color != "" {
+		colorMode = fileCfg.Color
+		if colorMode != "auto" && colorMode != "always" && colorMode != "never" {
+			usage("config: color must be auto, always or never")
+		}
+	}
+	nsOverride, kubeconfig, kubeContext := "", "", ""
+	var timeout, callTimeout time.Duration
+	var debug debugLog
+	chunkSize, useCache := int64(500), false
+	requestTimeout := 30 * time.Second
+	colOrder := ""
+	watch, interval, watchFile := false, 2*time.Second, ""
+	outFile, fromFile := "", ""
+	job := "" // --job label of -o prometheus
+	validate := false
+	oldestFirst := false // --sort-by age, as opposed to --sort-by-age
+	var ccols []customColumn
+	output := "" // -o other than custom-columns
+	minStr, maxStr := "", ""
+
+	/* -------- handle options -------- */
+	for i := 0; i < len(opts); i++ {
+		switch opts[i] {
+		case "-A":
+			allNS = true
+		case "-n":
+			nsOverride = opts[i+1]
+			i++
+		case "--kubeconfig":
+			if _, err := os.Stat(opts[i+1]); err != nil {
+				usage("--kubeconfig: " + err.Error())
+			}
+			kubeconfig = opts[i+1]
+			i++
+		case "--context":
+			kubeContext = opts[i+1]
+			i++
+		case "-l":
+			// repeated -l are ANDed, as the comma already does
+			if _, err := labels.Parse(opts[i+1]); err != nil {
+				usage("invalid label selector " + opts[i+1] + ": " + err.Error())
+			}
+			cfg.labelSel = strings.Trim(cfg.labelSel+","+opts[i+1], ",")
+			i++
+		case "--field-selector":
+			if scope != "pods" && scope != "containers" {
+				usage("--field-selector only valid for pods and containers")
+			}
+			if strings.TrimSpace(opts[i+1]) == "" {
+				usage("--field-selector expects a selector, e.g. status.phase!=Running")
+			}
+			if _, err := fields.ParseSelector(opts[i+1]); err != nil {
+				usage("invalid field selector " + opts[i+1] + ": " + err.Error())
+			}
+			cfg.fieldSel = opts[i+1]
+			i++
+		case "--node":
+			if scope != "pods" {
+				usage("--node only valid for pods")
+			}
+			cfg.nodeName = opts[i+1]
+			i++
+		case "-r":
+			reverse = true
+		case "-h":
+			units.mem = unitHuman
+		case "-k":
+			units.mem = unitKi
+		case "-m":
+			units.mem = unitMi
+		case "-g":
+			units.mem = unitGi
+		case "-T":
+			units.mem = unitTi
+		case "-b":
+			units.mem = unitBytes
+		case "--quantity":
+			units.mem = unitQuantity
+		case "--si":
+			units.si = true
+		case "--cpu", "--cpu-unit":
+			switch opts[i+1] {
+			case "cores":
+				units.cpu = cpuCores
+			case "milli":
+				units.cpu = cpuMilli
+			case "nano":
+				units.cpu = cpuNano
+			default:
+				usage(opts[i] + " expects milli, cores or nano")
+			}
+			i++
+		case "--precision":
+			n, err := strconv.Atoi(opts[i+1])
+			if err != nil || n < 0 || n > 9 {
+				usage("--precision expects a number of digits from 0 to 9")
+			}
+			units.precision = n
+			i++
+		case "-t", "--total":
+			cfg.total = true
+		case "--timeout":
+			timeout = parseDuration(opts[i], opts[i+1])
+			i++
+		case "--api-timeout-per-call":
+			callTimeout = parseDuration(opts[i], opts[i+1])
+			i++
+		case "--chunk-size":
+			// hidden: page size for pod, node and namespace lists, 0 = one request
+			n, err := strconv.ParseInt(opts[i+1], 10, 64)
+			if err != nil || n < 0 {
+				usage("--chunk-size expects a non-negative number")
+			}
+			chunkSize = n
+			i++
+		case "--use-cache":
+			useCache = true
+		case "--request-timeout":
+			requestTimeout = 0
+			if opts[i+1] != "" {
+				requestTimeout = parseDuration(opts[i], opts[i+1])
+			}
+			i++
+		case "--format-age":
+			cfg.age.unit = parseAgeUnit(opts[i+1])
+			i++
+		case "--age-precise":
+			cfg.age.unit = agePrecise
+		case "--ages":
+			if scope != "pods" {
+				usage("--ages only valid for pods")
+			}
+			cfg.ages = true
+		case "--age-from":
+			if scope != "pods" {
+				usage("--age-from only valid for pods")
+			}
+			switch opts[i+1] {
+			case "start":
+				cfg.ageStart = true
+			case "created":
+				cfg.ageStart = false
+			default:
+				usage("--age-from expects start or created")
+			}
+			i++
+		case "--explain":
+			if scope != "pods" {
+				usage("--explain only valid for pods")
+			}
+			cfg.explain = true
+		case "--merge-families":
+			cfg.score = true
+			metricPrimary = scoreKey
+		case "--only-metrics-missing":
+			cfg.missing = true
+		case "--pod-counts":
+			if scope != "namespaces" && scope != "nodes" {
+				usage("--pod-counts only valid for namespaces and nodes")
+			}
+			cfg.podCount = true
+		case "--show-scheduler":
+			if scope != "pods" {
+				usage("--show-scheduler only valid for pods")
+			}
+			cfg.sched = true
+		case "--scheduler":
+			if scope != "pods" {
+				usage("--scheduler only valid for pods")
+			}
+			cfg.schedFilter = opts[i+1]
+			i++
+		case "--owner":
+			if scope != "pods" {
+				usage("--owner only valid for pods")
+			}
+			cfg.ownerKind = opts[i+1]
+			i++
+		case "--top-pods-per-node":
+			if scope != "nodes" {
+				usage("--top-pods-per-node only valid for nodes")
+			}
+			n, err := strconv.Atoi(opts[i+1])
+			if err != nil || n < 1 {
+				usage("--top-pods-per-node expects a positive number")
+			}
+			cfg.topPods = n
+			i++
+		case "--wide-status":
+			if scope != "pods" {
+				usage("--wide-status only valid for pods")
+			}
+			cfg.wideStat = true
+		case "--node-status":
+			if scope != "pods" {
+				usage("--node-status only valid for pods")
+			}
+			cfg.nodeStat = true
+		case "--min":
+			minStr = opts[i+1]
+			i++
+		case "--max":
+			maxStr = opts[i+1]
+			i++
+		case "--no-headers":
+			cfg.noHeader = true
+		case "--color":
+			colorMode = opts[i+1]
+			if colorMode != "auto" && colorMode != "always" && colorMode != "never" {
+				usage("--color must be auto, always or never")
+			}
+			i++
+		case "--wide":
+			if scope != "pods" && scope != "nodes" {
+				usage("--wide only valid for pods and nodes")
+			}
+			cfg.wide = true
+		case "--no-trunc":
+			cfg.cellMax = 0
+		case "--group-by-namespace":
+			if scope != "pods" {
+				usage("--group-by-namespace only valid for pods")
+			}
+			cfg.groupNS = true
+		case "--collapse":
+			if scope != "pods" {
+				usage("--collapse only valid for pods")
+			}
+			cfg.collapse = true
+		case "--debug":
+			debug = true
+		case "--include-system-containers":
+			cfg.sysCont = true
+		case "--all-containers":
+			cfg.allConts = true
+		case "--show-orphans":
+			if scope != "pods" && scope != "nodes" {
+				usage("--show-orphans only valid for pods and nodes")
+			}
+			cfg.orphans = true
+			cfg.showNode = cfg.showNode || scope == "pods"
+		case "--resource":
+			i++ // read above
+		case "--fail-over":
+			v, err := strconv.ParseFloat(strings.TrimSuffix(opts[i+1], "%"), 64)
+			if err != nil || v <= 0 {
+				usage("--fail-over needs a positive percent, e.g. 90")
+			}
+			cfg.failOver = v
+			i++
+		case "--sort-by":
+			famOrder, metricPrimary = parseSortBy(opts[i+1], scope, cfg, famOrder)
+			oldestFirst = metricPrimary == ageKey
+			i++
+		case "--sort-by-age":
+			metricPrimary, oldestFirst = ageKey, false
+		case "--column-order":
+			colOrder = opts[i+1]
+			i++
+		case "-w", "--watch":
+			watch = true
+		case "--interval":
+			interval = parseDuration(opts[i], opts[i+1])
+			if interval == 0 {
+				usage("--interval must be positive")
+			}
+			i++
+		case "--validate":
+			validate = true
+		case "--job":
+			job = opts[i+1]
+			i++
+		case "--from-file":
+			fromFile = opts[i+1]
+			i++
+		case "--output-file":
+			outFile = opts[i+1]
+			i++
+		case "--watch-to-file":
+			watchFile = opts[i+1]
+			i++
+		case "-o":
+			switch spec, ok := strings.CutPrefix(opts[i+1], "custom-columns="); {
+			case ok:
+				ccols = parseCustomColumns(spec, cfg)
+			case slices.Contains([]string{"json", "jsonl", "yaml", "csv", "prometheus", "openmetrics"}, opts[i+1]):
+				output = opts[i+1]
+			default:
+				usage("unknown output format " + opts[i+1])
+			}
+			i++
+		case "--as-of":
+			t, err := time.Parse(time.RFC3339, opts[i+1])
+			if err != nil {
+				usage("--as-of expects an RFC3339 time, e.g. 2024-05-01T13:00:00Z")
+			}
+			cfg.age.asOf = t
+			i++
+		case "--config":
+			i++ // loaded above
+		case "--help":
+			usage("")
+		default:
+			usage("unknown option " + opts[i])
+		}
+	}
+	if watchFile != "" && !watch {
+		usage("--watch-to-file requires -w")
+	}
+	if scope == "all" && (watchFile != "" || ccols != nil || output != "") {
+		usage("all prints tables only; --watch-to-file and -o need a single scope")
+	}
+	if cfg.score && (!cfg.has('m') || !cfg.has('c') ||
+		!containsRune(cfg.metrics, 'u') || !containsRune(cfg.metrics, 'r')) {
+		usage("--merge-families requires m, c, u and r")
+	}
+	if cfg.failOver > 0 && !containsRune(cfg.metrics, 'p') && !containsRune(cfg.metrics, 'P') {
+		usage("--fail-over needs p or P in the flags")
+	}
+	if cfg.groupNS && !allNS {
+		usage("--group-by-namespace needs -A")
+	}
+	if job != "" && output != "prometheus" && output != "openmetrics" {
+		usage("--job needs -o prometheus or -o openmetrics")
+	}
+	if outFile != "" && watch {
+		usage("--output-file writes a single sample; use --watch-to-file with -w")
+	}
+	if cfg.failOver > 0 && watch {
+		usage("--fail-over checks a single sample; drop -w")
+	}
+	if cfg.missing && !containsRune(cfg.metrics, 'u') {
+		usage("--only-metrics-missing requires u")
+	}
+	if units.cpu == cpuNano {
+		cfg.table = cfg.table.withNanocores() // before --min/--max read their quantities
+	}
+	if minStr != "" || maxStr != "" {
+		if !strings.ContainsRune("rluftsdoT", metricPrimary) {
+			usage("--min/--max need a sort column in bytes or millicores (r, l, u, f, t, s, o, T or d)")
+		}
+		cfg.bounded, cfg.minV, cfg.maxV = true, math.Inf(-1), math.Inf(1)
+		if minStr != "" {
+			cfg.minV = parseThreshold("--min", minStr, cfg.table.of(famOrder))
+		}
+		if maxStr != "" {
+			cfg.maxV = parseThreshold("--max", maxStr, cfg.table.of(famOrder))
+		}
+	}
+	if units.si && (units.mem == unitBytes || units.mem == unitQuantity) {
+		usage("--si needs -h, -k, -m, -g or -T")
+	}
+	// the comparators put the newest first; --sort-by age reads the
+	// column oldest first, like kubectl get --sort-by creationTimestamp
+	if metricPrimary == ageKey && oldestFirst {
+		reverse = !reverse
+	}
+
+	if validate {
+		if colOrder != "" {
+			applyColumnOrder(&cfg, colOrder)
+		}
+		printResolved(os.Stderr, scope, cfg, famOrder, metricPrimary, reverse, units, output)
+		return
+	}
+
+	/* -------- kube config -------- */
+	var k *kube
+	var restCfg *rest.Config
+	curNS := "default"
+	if fromFile != "" {
+		static, err := loadStatic(fromFile, debug)
+		if err != nil {
+			usage("--from-file: " + err.Error())
+		}
+		k = &kube{static: static}
+	} else {
+		restCfg, curNS = mustBuildConfig(kubeconfig, kubeContext)
+		// bounds each HTTP request, so an unreachable cluster fails instead
+		// of hanging on the client default of no timeout
+		restCfg.Timeout = requestTimeout
+		k = &kube{core: mustClient(restCfg), callTimeout: callTimeout, chunkSize: chunkSize,
+			useCache: useCache}
+	}
+	k.debug = debug
+	if nsOverride != "" {
+		curNS = nsOverride
+	}
+
+	/* -------- metrics client (if needed) -------- */
+	if (containsRune(cfg.metrics, 'u') || containsRune(cfg.metrics, 'f')) && !cfg.quotaView() {
+		var mc *metricsclient.Clientset
+		err := errors.New("no usage with --from-file")
+		if restCfg != nil {
+			mc, err = metricsclient.NewForConfig(restCfg)
+		}
+		if err == nil {
+			k.metrics = mc
+		} else {
+			log.Printf("metrics-server unavailable: %v", err)
+			cfg, famOrder, metricPrimary = withoutUsage(cfg, flagsStr, famOrder, metricPrimary)
+		}
+	}
+
+	if colOrder != "" {
+		applyColumnOrder(&cfg, colOrder)
+	}
+	// tables only: the codes would end up inside -o and snapshot values
+	if colorMode == "always" || (colorMode == "auto" && outFile == "" && isTerminal(os.Stdout)) {
+		cfg.color = output == "" && ccols == nil && watchFile == ""
+	}
+	debug.printf("config %q: scope=%s flags=%s columns=%s sort=%c%c reverse=%v namespace=%q all=%v",
+		cfgPath, scope, flagsStr, string(cfg.cols()), famOrder, metricPrimary, reverse, curNS, allNS)
+
+	/* -------- dispatch by scope -------- */
+	// a single sample is collected before anything is written, so a
+	// failed or interrupted run prints no partial table and leaves no
+	// truncated --output-file behind
+	var out io.Writer = os.Stdout
+	var buf bytes.Buffer
+	if !watch {
+		out = &buf
+	}
+	objects := func(ctx context.Context) []Row {
+		switch scope {
+		case "pods":
+			return podObjects(mustGet(collectPods(ctx, k, curNS, allNS, cfg, famOrder, metricPrimary, reverse)), cfg)
+		case "containers":
+			return containerObjects(mustGet(collectContainers(ctx, k, curNS, allNS, cfg, famOrder, metricPrimary, reverse)), cfg)
+		case "deployments":
+			return deployObjects(mustGet(collectDeployments(ctx, k, curNS, allNS, cfg, famOrder, metricPrimary, reverse)), cfg)
+		case "nodes":
+			return nodeObjects(mustGet(collectNodes(ctx, k, cfg, famOrder, metricPrimary, reverse)), cfg)
+		case "pvc":
+			return pvcObjects(mustGet(collectPVCs(ctx, k, curNS, allNS, cfg, famOrder, metricPrimary, reverse)), cfg)
+		default:
+			return nsObjects(mustGet(collectNamespaces(ctx, k, cfg, famOrder, metricPrimary, reverse)), cfg)
+		}
+	}
+	render := func(ctx context.Context) {
+		switch scope {
+		case "pods":
+			printPods(out, mustGet(collectPods(ctx, k, curNS, allNS, cfg, famOrder, metricPrimary, reverse)),
+				cfg, allNS, famOrder, units)
+		case "containers":
+			printContainers(out, mustGet(collectContainers(ctx, k, curNS, allNS, cfg, famOrder, metricPrimary, reverse)),
+				cfg, allNS, famOrder, units)
+		case "deployments":
+			printDeployments(out, mustGet(collectDeployments(ctx, k, curNS, allNS, cfg, famOrder, metricPrimary, reverse)),
+				cfg, allNS, famOrder, units)
+		case "nodes":
+			printNodes(out, mustGet(collectNodes(ctx, k, cfg, famOrder, metricPrimary, reverse)),
+				cfg, famOrder, units)
+		case "namespaces":
+			printNS(out, mustGet(collectNamespaces(ctx, k, cfg, famOrder, metricPrimary, reverse)),
+				cfg, famOrder, units)
+		case "pvc":
+			printPVCs(out, mustGet(collectPVCs(ctx, k, curNS, allNS, cfg, famOrder, metricPrimary, reverse)),
+				cfg, allNS, famOrder, units)
+		case "all":
+			fmt.Fprintln(out, "==> pods <==")
+			printPods(out, mustGet(collectPods(ctx, k, curNS, allNS, cfg, famOrder, metricPrimary, reverse)),
+				cfg, allNS, famOrder, units)
+			fmt.Fprintln(out, "\n==> nodes <==")
+			printNodes(out, mustGet(collectNodes(ctx, k, cfg, famOrder, metricPrimary, reverse)),
+				cfg, famOrder, units)
+			fmt.Fprintln(out, "\n==> namespaces <==")
+			printNS(out, mustGet(collectNamespaces(ctx, k, cfg, famOrder, metricPrimary, reverse)),
+				cfg, famOrder, units)
+		}
+	}
+	switch {
+	case watchFile != "":
+		render = func(ctx context.Context) {
+			must(appendSnapshot(watchFile, scope, objects(ctx)))
+		}
+	case ccols != nil:
+		render = func(ctx context.Context) {
+			printCustomColumns(out, objects(ctx), ccols, cfg, units)
+		}
+	case output == "json":
+		render = func(ctx context.Context) {
+			must(printJSON(out, objects(ctx)))
+		}
+	case output == "jsonl":
+		render = func(ctx context.Context) {
+			must(printJSONL(out, objects(ctx)))
+		}
+	case output == "yaml":
+		render = func(ctx context.Context) {
+			must(printYAML(out, objects(ctx), units))
+		}
+	case output == "prometheus" || output == "openmetrics":
+		po := promOpts{job: job, openMetrics: output == "openmetrics"}
+		render = func(ctx context.Context) {
+			must(printPrometheus(out, objects(ctx), scope, cfg, po))
+		}
+	case output == "csv":
+		render = func(ctx context.Context) {
+			var lead, tail []string
+			var lines []csvLine
+			switch scope {
+			case "pods":
+				lead, tail, lines = podCSV(mustGet(collectPods(ctx, k, curNS, allNS, cfg, famOrder, metricPrimary, reverse)), cfg, allNS)
+			case "containers":
+				lead, tail, lines = containerCSV(mustGet(collectContainers(ctx, k, curNS, allNS, cfg, famOrder, metricPrimary, reverse)), cfg, allNS)
+			case "deployments":
+				lead, tail, lines = deployCSV(mustGet(collectDeployments(ctx, k, curNS, allNS, cfg, famOrder, metricPrimary, reverse)), allNS)
+			case "nodes":
+				lead, tail, lines = nodeCSV(mustGet(collectNodes(ctx, k, cfg, famOrder, metricPrimary, reverse)))
+			case "pvc":
+				lead, tail, lines = pvcCSV(mustGet(collectPVCs(ctx, k, curNS, allNS, cfg, famOrder, metricPrimary, reverse)), allNS)
+			default:
+				lead, tail, lines = nsCSV(mustGet(collectNamespaces(ctx, k, cfg, famOrder, metricPrimary, reverse)))
+			}
+			must(printCSV(out, lead, tail, lines, cfg, famOrder, units))
+		}
+	}
+
+	draw := render
+	render = func(ctx context.Context) {
+		draw(ctx)
+		k.warnEmptyUsage()
+	}
+
+	sigCtx, stop := signalContext()
+	defer stop()
+	if !watch {
+		ctx, cancel := sampleContext(sigCtx, timeout)
+		render(ctx)
+		cancel()
+		if sigCtx.Err() != nil {
+			os.Exit(130)
+		}
+		if outFile != "" {
+			if err := os.WriteFile(outFile, buf.Bytes(), 0o644); err != nil {
+				log.Fatalf("--output-file: %v", err)
+			}
+		} else {
+			buf.WriteTo(os.Stdout)
+		}
+		if k.stats.failedOver {
+			os.Exit(2)
+		}
+		return
+	}
+	watchLoop(sigCtx, interval, timeout, watchFile == "" && output == "", render)
+}
+
+/* ---------- flag parsing ---------- */
+
+// splitArgs separates the scope, the flags string and the options.
+// Options may appear anywhere, value options take "-n ns" as well as
+// "-n=ns", and further flag tokens are merged into the first one, so
+// "pods mcu -n foo mru" means "pods mcur -n foo". Options are returned
+// as name/value pairs for value options and bare names otherwise.
+func splitArgs(args []string) (scope, flags string, opts []string, err error) {
+	known := scopeLetters["pods"] + scopeLetters["nodes"] + scopeLetters["namespaces"]
+
+	for i := 0; i < len(args); i++ {
+		tok := args[i]
+
+		/* option (starts with “-”) */
+		if strings.HasPrefix(tok, "-") && len(tok) > 1 {
+			name, val, hasVal := strings.Cut(tok, "=")
+			if !valueOpts[name] {
+				if hasVal {
+					return "", "", nil, fmt.Errorf("argument %d %q: option %s takes no value", i+1, tok, name)
+				}
+				opts = append(opts, tok)
+				continue
+			}
+			if !hasVal {
+				if i+1 >= len(args) {
+					return "", "", nil, fmt.Errorf("argument %d: missing value after %s", i+1, tok)
+				}
+				i++
+				val = args[i]
+			}
+			opts = append(opts, name, val)
+			continue
+		}
+
+		/* first positional is the scope, the rest make up the flags */
+		switch {
+		case scope == "":
+			scope = tok
+		case flags == "":
+			flags = tok
+		default:
+			for _, ch := range tok {
+				if !strings.ContainsRune(known, ch) {
+					return "", "", nil, fmt.Errorf("argument %d %q: unexpected argument (flags string is %q)", i+1, tok, flags)
+				}
+			}
+			flags = mergeFlags(flags, tok)
+		}
+	}
+	return scope, flags, opts, nil
+}
+
+// mergeFlags appends the letters of more that flags does not have yet;
+// p is positional and therefore always kept.
+func mergeFlags(flags, more string) string {
+	for _, ch := range more {
+		if ch == 'p' || !strings.ContainsRune(flags, ch) {
+			flags += string(ch)
+		}
+	}
+	return flags
+}
+
+func usage(msg string) {
+	if msg != "" {
+		fmt.Fprintln(os.Stderr, "Error:", msg)
+	}
+	fmt.Fprint(os.Stderr, `Usage:
+    kubectl ps <pods|containers|deployments|nodes|namespaces|pvc|all> <flags> [options]
+    kubectl ps version
+
+Scopes:
+    pods | nodes | namespaces
+    containers
+           one row per container (POD, CONTAINER), pods letters
+    deployments
+           pods summed per Deployment with READY and NODES (ends in
+           ! when more than one replica is wanted but every pod is on
+           one node), namespaces letters
+    pvc    PersistentVolumeClaims: m only, r requested storage, l/t
+           bound capacity, plus p and b
+    all    the three tables in turn; flags limited to mcrlupd,
+           default mcu
+
+Metric flags:
+    m  memory      u  usage
+    c  cpu         r  requests
+    p  percent     l  limits
+    e  ephemeral   d  delta (usage - requests)
+       storage     b  burst ratio (limits / requests, pods/namespaces)
+       (pods, nodes, namespaces; no usage)
+                   n  node  (pods only)
+                   x  restarts (pods only; sorts when before the
+                      first metric letter)
+                   q  QoS class (pods only)
+                   P  share of the node's allocatable (pods, nodes)
+                   f  free  (nodes only)
+                   t  total (nodes; namespaces: ResourceQuota hard,
+                      with l and u then the quota's limits and used)
+                   s  reserved: capacity - allocatable (nodes only)
+                   o  pod limits summed (nodes, where l is
+                      allocatable; oP: limit overcommit)
+                   T  capacity, the hardware before reservations
+                      (nodes only)
+
+Options:
+    -A                all namespaces / all nodes
+    -n <namespace>    select namespace
+    --kubeconfig <path>
+                      kubeconfig file instead of $KUBECONFIG/~/.kube/config
+    --context <name>  kubeconfig context to use instead of the current one
+    -l <selector>     only pods, nodes or namespaces (by scope) matching
+                      the label selector, e.g. app=nginx,tier!=cache;
+                      repeatable, all must match
+    --field-selector <selector>
+                      pods: server-side field filter,
+                      e.g. status.phase!=Running
+    --node <name>     pods: only pods scheduled on this node
+    -r                reverse sort
+    -h                human-readable units
+    -k                kibibytes
+    -m                mebibytes
+    -g                gibibytes
+    -T                tebibytes
+    -b                bytes
+    --quantity        Kubernetes quantities (512Mi, 250m) for manifests
+    --si              decimal memory units with -h/-k/-m/-g/-T: powers of
+                      1000, human sizes as MB/GB/TB
+    --precision <n>   fractional digits of memory values (default 1 for
+                      M/Mi, 2 for G/Gi)
+    --cpu <unit>      CPU as milli (default, 2500), cores (2.5) or nano
+                      (2500000000); also --cpu-unit
+    -t                show TOTAL
+    --group-by-namespace
+                      pods -A: rows grouped by namespace, each group
+                      followed by a SUBTOTAL row
+    --collapse        pods: one row per controller (Deployment, StatefulSet,
+                      ...) with summed metrics, READY as ready/total pods
+                      and STATUS such as "10 Running"
+    --no-headers      omit the header line of tables (not -o json/yaml/csv)
+    --color <when>    auto|always|never (default auto: on a terminal);
+                      percent, free and SCORE cells yellow over 80%,
+                      red over 90% used
+    --fail-over <pct> exit 2 after printing when any row's p or P, in
+                      any family of the flags, is above pct
+    --wide            pods: add POD-IP, NODE and IMAGES; nodes: add
+                      INTERNAL-IP and ROLES
+    --no-trunc        do not cut NAME, NODE and IMAGES cells at 48
+                      characters (tables only; -o never cuts)
+    --resource <name> extra family for an extended resource such as
+                      nvidia.com/gpu (requests, limits, allocatable;
+                      counts, no usage); repeatable
+    --timeout <d>     overall deadline for all API calls (e.g. 30s)
+    --api-timeout-per-call <d>
+                      deadline for each individual API call
+    --request-timeout <d>
+                      HTTP timeout of a single request (default 30s; 0 or
+                      "" for none)
+    --use-cache       read lists from the API server cache (faster on big
+                      clusters, may lag etcd by a moment)
+    --format-age <u>  auto|seconds|minutes|hours|days (default auto:
+                      45s, 12m, 5h, 3d)
+    --age-precise     ages to the second with two units: 45s, 5m12s, 2d3h
+    --as-of <time>    compute ages relative to an RFC3339 time
+    --column-order <letters>
+                      display order of families and metrics, e.g. cur
+    --ages            pods: CREATED, READY-SINCE and LAST-RESTART columns
+    --age-from <t>    pods: AGE counts from created (default) or start,
+                      the pod's status.startTime
+    --explain         pods: REASON column telling why Pending pods wait
+    --merge-families  SCORE column (max of mem and cpu usage/requests),
+                      used as the sort key
+    --only-metrics-missing
+                      only rows metrics-server returned no usage for
+    --sort-by <col>   sort by name, status, age or a metric column such
+                      as mem.req or cpu.use instead of the flags order:
+                      name and status A to Z, age oldest first, metrics
+                      largest first; -r flips each
+    --sort-by-age     newest first (-r: oldest first)
+    --show-scheduler  pods: SCHEDULER column
+    --pod-counts      namespaces: RUNNING, PENDING and FAILED columns
+                      counting the pods in each phase; nodes: POD_COUNT
+                      and NOTREADY, the pods on the node and those of
+                      them not Ready (finished ones left out)
+    --node-status     pods: NODE-STATUS column with the node's readiness,
+                      red with --color when NotReady or Missing
+    --min <q>, --max <q>
+                      only rows whose sort column is within the bounds,
+                      as quantities of the sort family: 512Mi, 2Gi or
+                      250m, 1.5
+    --debug           log config, API calls, object counts and filtering
+                      to stderr
+    --include-system-containers
+                      count the pause (POD) container in usage; it is
+                      left out by default
+    --all-containers  count init and ephemeral containers in requests and
+                      limits (containers: list them too); by default only
+                      app containers, init ones as the scheduler reserves
+    --show-orphans    pods: only pods bound to a node that no longer
+                      exists; nodes: a Missing row per vanished node
+                      carrying its pods' requests and usage
+    --wide-status     pods: STATUS with container reasons, as kubectl
+                      shows it (e.g. Init:CrashLoopBackOff (2/3))
+    --top-pods-per-node <N>
+                      nodes: list the top N pods by the sort metric
+                      under each node
+    --scheduler <name>
+                      pods: only pods handled by this scheduler
+    --owner <kind>    pods: only pods whose controller is of this kind
+                      (DaemonSet, StatefulSet, Job, Deployment, ...), or
+                      none for standalone pods
+    -w, --watch       redraw every --interval until Ctrl-C, like top
+    --interval <d>    time between samples with -w (default 2s)
+    --watch-to-file <path>
+                      with -w, append each sample as a JSON line to path
+    --output-file <path>
+                      write the table, or the -o format, to path instead
+                      of stdout (not with -w)
+    --from-file <path>
+                      read the objects of a kubectl get -o yaml|json dump
+                      instead of a cluster (no usage)
+    --config <path>   defaults file (default ~/.kube/ps.yaml)
+    --validate        print how the scope, flags and options were read
+                      (families, columns, sort, units) to stderr and exit
+                      without contacting the cluster
+    -o json           rows as a JSON array (bytes, millicores or with
+                      --cpu nano nanocores, null when not reported)
+    -o jsonl          the same objects one per line, no array; TOTAL is
+                      the last line, with "total": true
+    -o yaml           the same rows with each value also formatted in
+                      the selected units
+    -o csv            comma-separated table; absent values are empty,
+                      AGE_SECONDS precedes the human AGE
+    -o prometheus     text exposition format, e.g.
+                      kubectl_ps_pod_memory_requests_bytes{...} (cpu in
+                      cores), for node_exporter's textfile collector
+    -o openmetrics    the same series in the OpenMetrics format, each
+                      sample with a timestamp, ending in # EOF
+    --job <name>      -o prometheus/openmetrics: label every series with
+                      job="name", e.g. when run as a batch job
+    -o custom-columns=<HEADER:.path,...>
+                      kubectl-style columns; paths: .name .namespace .pod
+                      .status .ready .qos .node .reason .age .created
+                      .mem.<m> .cpu.<m>
+`)
+	os.Exit(1)
+}
+
+func parseDuration(opt, val string) time.Duration {
+	d, err := time.ParseDuration(val)
+	if err != nil || d < 0 {
+		usage("invalid duration for " + opt + ": " + val)
+	}
+	return d
+}
+
+// sortNames are the metric halves of --sort-by columns such as mem.req.
+var sortNames = map[rune]string{'r': "req", 'l': "lim", 'u': "use", 'p': "pct", 'P': "alloc",
+	'd': "delta", 'b': "ratio", 'f': "free", 't': "total", 's': "reserved", 'o': "podlim", 'T': "cap"}
+
+// parseSortBy reads --sort-by: name, status, age or <family>.<metric>
+// with the metric as a letter, a JSON name or a header suffix (mem.req,
+// cpu.usage, memory.r). The metric must be one of the flags.
+func parseSortBy(val, scope string, cfg columnCfg, fam rune) (rune, rune) {
+	var metric rune
+	switch val {
+	case "name":
+		return fam, nameKey
+	case "age":
+		return fam, ageKey
+	case "status":
+		if scope == "containers" || scope == "deployments" {
+			usage("--sort-by status not valid for " + scope)
+		}
+		return fam, statusKey
+	}
+	// the metric follows the last dot: resource names have dots too
+	famName, metricName := val, ""
+	if i := strings.LastIndex(val, "."); i >= 0 {
+		famName, metricName = val[:i], val[i+1:]
+	}
+	if fam = cfg.table.byName(famName); fam == 0 {
+		usage("--sort-by: unknown column " + val + " (name, status, age or e.g. mem.req, cpu.use)")
+	}
+	metric = metricLetter(metricName)
+	for ch, s := range sortNames {
+		if metricName == s || (metric == 0 && metricName == string(ch)) {
+			metric = ch
+		}
+	}
+	if metric == 0 {
+		usage("--sort-by: unknown metric " + metricName + " in " + val)
+	}
+	if !containsRune(cfg.metrics, metric) || !cfg.has(fam) {
+		usage("--sort-by: " + val + " is not in the flags string")
+	}
+	return fam, metric
+}
+
+// parseThreshold reads a --min/--max quantity in the unit rows store for
+// the sort family: bytes for memory, millicores for CPU.
+func parseThreshold(opt, val string, f family) float64 {
+	q, err := resource.ParseQuantity(val)
+	if err != nil {
+		usage("invalid quantity for " + opt + ": " + val)
+	}
+	return float64(f.quantityValue(q))
+}
+
+func parseScope(s string) string {
+	switch strings.ToLower(s) {
+	case "pod", "pods", "po", "p":
+		return "pods"
+	case "container", "containers", "co":
+		return "containers"
+	case "deploy", "deployment", "deployments":
+		return "deployments"
+	case "node", "nodes", "no", "n":
+		return "nodes"
+	case "ns", "namespace", "namespaces":
+		return "namespaces"
+	case "pvc", "pvcs", "persistentvolumeclaim", "persistentvolumeclaims":
+		return "pvc"
+	case "all":
+		return "all"
+	default:
+		usage("unknown scope " + s)
+		return ""
+	}
+}
+
+func parseFlags(flags, scope string) (columnCfg, error) {
+	cfg := columnCfg{table: famTable}
+
+	valid := scopeLetters[scope]
+	hint := fmt.Sprintf(" (valid for %s: %s)", scope, valid)
+
+	for _, ch := range flags {
+		if !strings.ContainsRune(valid, ch) {
+			if strings.ContainsRune(scopeLetters["pods"]+scopeLetters["nodes"], ch) {
+				return cfg, errors.New("flag " + string(ch) + " not valid for " + scope + hint)
+			}
+			return cfg, errors.New("unknown flag letter " + string(ch) + hint)
+		}
+		switch {
+		case famTable.has(ch):
+			if !cfg.has(ch) {
+				cfg.fams = append(cfg.fams, ch)
+			}
+		case ch == 'n':
+			cfg.showNode = true
+		case ch == 'x':
+			cfg.restarts = true
+		case ch == 'q':
+			cfg.qos = true
+		case ch != 'p' && ch != 'P' && containsRune(cfg.metrics, ch):
+			return cfg, errors.New("flag " + string(ch) + " given twice; only p and P may repeat")
+		default:
+			cfg.metrics = append(cfg.metrics, ch)
+		}
+	}
+
+	cfg.storage = scope == "pvc"
+	cfg.scope = scope
+	if len(cfg.fams) == 0 {
+		return cfg, errors.New("flags must include a family letter" + hint)
+	}
+	if len(cfg.metrics) == 0 && !cfg.restarts && !cfg.qos {
+		return cfg, errors.New("flags must include at least one metric letter" + hint)
+	}
+	if containsRune(cfg.metrics, 'd') &&
+		(!containsRune(cfg.metrics, 'u') || !containsRune(cfg.metrics, 'r')) {
+		return cfg, errors.New("flag d requires both u and r")
+	}
+	if containsRune(cfg.metrics, 'b') &&
+		(!containsRune(cfg.metrics, 'l') || !containsRune(cfg.metrics, 'r')) {
+		return cfg, errors.New("flag b requires both l and r")
+	}
+	// each p needs a pair of its own: a second p right after the first
+	// would print the same ratio again
+	seen := map[[2]rune]bool{}
+	for i, m := range cfg.metrics {
+		if m != 'p' {
+			continue
+		}
+		x, y := pctLetters(cfg.metrics, i)
+		if y == 0 {
+			continue
+		}
+		if x == y || seen[[2]rune{x, y}] {
+			return cfg, fmt.Errorf("a second p divides %c by %c again; put each p after the two columns it compares", x, y)
+		}
+		seen[[2]rune{x, y}] = true
+	}
+	shared := map[rune]bool{}
+	for i, m := range cfg.metrics {
+		if m != 'P' {
+			continue
+		}
+		x := allocLetter(cfg.metrics, i)
+		if shared[x] {
+			return cfg, fmt.Errorf("a second P divides %c by allocatable again; put each P after the column it shares", x)
+		}
+		shared[x] = true
+	}
+	return cfg, nil
+}
+
+// applyColumnOrder reorders the rendered columns without touching what
+// is computed or sorted: family letters set the family order, metric
+// letters the column order, a repeated one such as p moving all of its
+// columns in flag order; anything not listed keeps its flag order after
+// the listed ones.
+func applyColumnOrder(cfg *columnCfg, order string) {
+	var fams []rune
+	var cols []int
+	for _, ch := range order {
+		switch {
+		case cfg.table.has(ch):
+			if !containsRune(fams, ch) {
+				fams = append(fams, ch)
+			}
+		case containsRune(cfg.metrics, ch):
+			for i, m := range cfg.metrics {
+				if m == ch && !slices.Contains(cols, i) {
+					cols = append(cols, i)
+				}
+			}
+		case isMetric(ch):
+			usage("--column-order: metric " + string(ch) + " not in flags")
+		default:
+			usage("--column-order: unknown letter " + string(ch))
+		}
+	}
+	for i := range cfg.metrics {
+		if !slices.Contains(cols, i) {
+			cols = append(cols, i)
+		}
+	}
+	for _, f := range cfg.table {
+		if len(fams) > 0 && !containsRune(fams, f.letter) {
+			fams = append(fams, f.letter)
+		}
+	}
+	cfg.columns = cols
+	if len(fams) > 0 {
+		cfg.famOrder = fams
+	}
+}
+
+// withoutUsage drops everything computed from usage (u, p, d and f) when
+// metrics-server is out of reach; a sort on one of them falls back to the
+// next letter of flags.
+func withoutUsage(cfg columnCfg, flags string, fam, metric rune) (columnCfg, rune, rune) {
+	needsUsage := func(r rune) bool { return strings.ContainsRune("updf", r) }
+	cfg.metrics = filterRunes(cfg.metrics, func(r rune) bool { return !needsUsage(r) })
+	if needsUsage(metric) {
+		fam, metric = detectSort(strings.Map(func(r rune) rune {
+			if needsUsage(r) {
+				return -1
+			}
+			return r
+		}, flags))
+	}
+	return cfg, fam, metric
+}
+
+func containsRune(slice []rune, r rune) bool {
+	for _, x := range slice {
+		if x == r {
+			return true
+		}
+	}
+	return false
+}
+
+func filterRunes(slice []rune, keep func(rune) bool) []rune {
+	out := make([]rune, 0, len(slice))
+	for _, r := range slice {
+		if keep(r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func detectSort(flags string) (fam, metric rune) {
+	fam, metric = 'm', 'r'
+	for _, ch := range flags {
+		if famTable.has(ch) {
+			fam = ch
+			break
+		}
+	}
+	for _, ch := range flags {
+		if isMetric(ch) || ch == restartKey {
+			metric = ch
+			break
+		}
+	}
+	return
+}
+
+// printResolved is --validate: how the arguments were understood, from
+// the families down to the sort key and units, without a cluster.
+func printResolved(w io.Writer, scope string, cfg columnCfg, fam, metric rune, rev bool,
+	u unitCfg, output string) {
+
+	var fams []string
+	for _, f := range cfg.families(fam) {
+		fams = append(fams, cfg.table.of(f).names[0])
+	}
+	var cols strings.Builder
+	writeHeaders(&cols, cfg, fam)
+	sortKey := map[rune]string{nameKey: "name, A to Z", ageKey: "age, newest first", statusKey: "status, A to Z",
+		restartKey: "restarts, most first", scoreKey: "SCORE, highest first"}[metric]
+	if sortKey == "" {
+		sortKey = cfg.table.of(fam).names[0] + "." + sortNames[metric] + ", largest first"
+	}
+	switch {
+	case metric == ageKey && rev:
+		sortKey = "age, oldest first" // -r or --sort-by age
+	case rev:
+		sortKey += ", reversed (-r)"
+	}
+	mem := []string{"human", "ki", "mi", "gi", "ti", "bytes", "quantity"}[u.mem]
+	if u.si {
+		mem += ", si"
+	}
+	if u.precision >= 0 {
+		mem += fmt.Sprintf(", precision %d", u.precision)
+	}
+	cpu := []string{"milli", "cores", "nano"}[u.cpu]
+	if output == "" {
+		output = "table"
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "scope\t%s\n", scope)
+	fmt.Fprintf(tw, "families\t%s\n", strings.Join(fams, " "))
+	fmt.Fprintf(tw, "columns\t%s\n", strings.Join(strings.Fields(cols.String()), " "))
+	fmt.Fprintf(tw, "sort\t%s\n", sortKey)
+	fmt.Fprintf(tw, "units\tmemory %s; cpu %s\n", mem, cpu)
+	fmt.Fprintf(tw, "output\t%s\n", output)
+	tw.Flush()
+}
+
+/* ---------- unit helpers ---------- */
+
+type unitKind int
+
+const (
+	unitHuman unitKind = iota
+	unitKi
+	unitMi
+	unitGi
+	unitTi
+	unitBytes
+	unitQuantity // Kubernetes quantity strings: 512Mi, 250m
+)
+
+type cpuUnit int
+
+const (
+	cpuMilli cpuUnit = iota
+	cpuCores
+	cpuNano // stored as nanocores too, see withNanocores
+)
+
+// unitCfg is everything the format functions need to print a value.
+type unitCfg struct {
+	mem       unitKind
+	si        bool    // --si: powers of 1000, human sizes as MB/GB/TB
+	precision int     // --precision fractional digits, -1 = the unit's own
+	cpu       cpuUnit // --cpu: 2500 millicores, 2.5 cores or 2500000000 nanocores
+}
+
+func parseUnits(s string) unitKind {
+	switch strings.ToLower(s) {
+	case "human", "h":
+		return unitHuman
+	case "ki", "k":
+		return unitKi
+	case "mi", "m":
+		return unitMi
+	case "gi", "g":
+		return unitGi
+	case "ti", "t":
+		return unitTi
+	case "bytes", "b":
+		return unitBytes
+	case "quantity", "q":
+		return unitQuantity
+	default:
+		usage("unknown units " + s)
+		return unitHuman
+	}
+}
+
+func memFmt(b int64, u unitCfg) string {
+	div, suffix := 1024.0, ""
+	if u.si {
+		div, suffix = 1000, "B"
+	}
+	// digits is the unit's default unless --precision overrides it
+	digits := func(def int) int {
+		if u.precision >= 0 {
+			return u.precision
+		}
+		return def
+	}
+	k := float64(b) / div
+	m, g := k/div, k/div/div
+	switch u.mem {
+	case unitQuantity:
+		return memQuantity(b)
+	case unitBytes:
+		return fmt.Sprintf("%d", b)
+	case unitKi:
+		return strconv.FormatFloat(k, 'f', digits(0), 64)
+	case unitMi:
+		return strconv.FormatFloat(m, 'f', digits(1), 64)
+	case unitGi:
+		return strconv.FormatFloat(g, 'f', digits(2), 64)
+	case unitTi:
+		return strconv.FormatFloat(g/div, 'f', digits(3), 64)
+	default:
+		if g >= div {
+			return strconv.FormatFloat(g/div, 'f', digits(2), 64) + "T" + suffix
+		}
+		if g >= 1 {
+			return strconv.FormatFloat(g, 'f', digits(2), 64) + "G" + suffix
+		}
+		return strconv.FormatFloat(m, 'f', digits(1), 64) + "M" + suffix
+	}
+}
+
+// memQuantity renders bytes as a canonical quantity. Sizes that are not
+// a whole number of Ki/Mi/Gi would print as raw bytes, so they are
+// rounded up to the next Mi first; the result can go straight into a
+// requests field.
+func memQuantity(b int64) string {
+	const mi = 1024 * 1024
+	if b >= mi && b%1024 != 0 {
+		b = (b + mi - 1) / mi * mi
+	}
+	return resource.NewQuantity(b, resource.BinarySI).String()
+}
+
+// cpuFmt renders cpu in its stored unit: bare millicores or nanocores,
+// cores with --cpu cores, or "250m"/"2" quantities.
+func cpuFmt(m int64, u unitCfg) string {
+	switch {
+	case u.mem == unitQuantity && u.cpu == cpuNano:
+		return resource.NewScaledQuantity(m, resource.Nano).String()
+	case u.mem == unitQuantity:
+		return resource.NewMilliQuantity(m, resource.DecimalSI).String()
+	case u.cpu == cpuCores:
+		return strconv.FormatFloat(float64(m)/1000, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%d", m)
+}
+
+// countFmt prints extended resources, which are whole devices.
+func countFmt(n int64, _ unitCfg) string { return strconv.FormatInt(n, 10) }
+
+// deltaValue returns usage minus requests, or false when either is absent.
+func deltaValue(mp map[rune]int64) (int64, bool) {
+	if mp['u'] < 0 || mp['r'] < 0 {
+		return 0, false
+	}
+	return mp['u'] - mp['r'], true
+}
+
+// ratioValue returns limits divided by requests, or false when either is
+// absent or requests are zero.
+func ratioValue(mp map[rune]int64) (float64, bool) {
+	if mp['r'] <= 0 || mp['l'] < 0 {
+		return 0, false
+	}
+	return float64(mp['l']) / float64(mp['r']), true
+}
+
+func signed(v int64, abs string) string {
+	if v < 0 {
+		return "-" + abs
+	}
+	return "+" + abs
+}
+
+func pct(x, y int64) string {
+	if x <= 0 || y <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", float64(x)*100/float64(y))
+}
+
+type ageUnit int
+
+const (
+	ageAuto ageUnit = iota
+	ageSeconds
+	ageMinutes
+	ageHours
+	ageDays
+	agePrecise // --age-precise: 45s, 5m12s, 3h20m, 2d3h
+)
+
+// ageOpts is how ages are printed: the unit, and the time they are
+// measured to, --as-of or, when zero, the moment of printing.
+type ageOpts struct {
+	unit ageUnit
+	asOf time.Time
+}
+
+func (a ageOpts) now() time.Time {
+	if a.asOf.IsZero() {
+		return time.Now()
+	}
+	return a.asOf
+}
+
+func parseAgeUnit(s string) ageUnit {
+	switch strings.ToLower(s) {
+	case "auto":
+		return ageAuto
+	case "seconds", "s":
+		return ageSeconds
+	case "minutes", "m":
+		return ageMinutes
+	case "hours", "h":
+		return ageHours
+	case "days", "d":
+		return ageDays
+	default:
+		usage("unknown age unit " + s)
+		return ageAuto
+	}
+}
+
+// ageFmt renders the age of t; seconds are printed bare so they can be
+// fed straight into calculations.
+func ageFmt(t time.Time, a ageOpts) string {
+	if t.IsZero() {
+		return "-"
+	}
+	d := a.now().Sub(t)
+	if d < 0 {
+		return "-" // did not exist yet at --as-of
+	}
+	switch a.unit {
+	case ageSeconds:
+		return fmt.Sprintf("%d", int64(d.Seconds()))
+	case ageMinutes:
+		return fmt.Sprintf("%dm", int64(d.Minutes()))
+	case ageHours:
+		return fmt.Sprintf("%dh", int64(d.Hours()))
+	case ageDays:
+		return fmt.Sprintf("%dd", int64(d.Hours()/24))
+	case agePrecise:
+		return preciseAge(d)
+	}
+	if d.Hours() >= 48 {
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+	if d.Hours() >= 1 {
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds())) // not 0m for a fresh pod
+	}
+	return fmt.Sprintf("%dm", int(d.Minutes()))
+}
+
+// preciseAge prints the two largest units of d, dropping a zero second
+// one, with the same 48h switch to days as the compact form.
+func preciseAge(d time.Duration) string {
+	s := int64(d.Seconds())
+	var big, small int64
+	var bu, su string
+	switch {
+	case s < 60:
+		return fmt.Sprintf("%ds", s)
+	case s < 3600:
+		big, bu, small, su = s/60, "m", s%60, "s"
+	case s < 48*3600:
+		big, bu, small, su = s/3600, "h", s%3600/60, "m"
+	default:
+		big, bu, small, su = s/86400, "d", s%86400/3600, "h"
+	}
+	if small == 0 {
+		return fmt.Sprintf("%d%s", big, bu)
+	}
+	return fmt.Sprintf("%d%s%d%s", big, bu, small, su)
+}
+
+/* ---------- pods ---------- */
+
+type podRow struct {
+	ns, name, status, node  string
+	ip                      string // --wide; empty until assigned
+	images                  string // --wide: spec container images, comma-joined
+	ready                   string // ready/total containers
+	reason                  string // --explain
+	scheduler               string
+	nodeStatus              string // --node-status
+	restarts                int64  // x; -1 before any container status
+	qos                     string // q
+	created                 time.Time
+	started                 time.Time // Status.StartTime; zero until set
+	readySince, lastRestart time.Time // zero when not ready / never restarted
+	ctrlKind, ctrlName      string    // --collapse: controller, ReplicaSet hash cut
+	vals                    famMaps
+}
+
+// since is what the pod's AGE counts from: its start with --age-from
+// start, else (or before the kubelet started it) its creation.
+func (r podRow) since(cfg columnCfg) time.Time {
+	if cfg.ageStart && !r.started.IsZero() {
+		return r.started
+	}
+	return r.created
+}
+
+// truncate cuts s to max runes, the last one an ellipsis; max 0 keeps it.
+func truncate(s string, max int) string {
+	if max <= 0 || utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max-1]) + "…"
+}
+
+// podImages lists the images of the spec containers, init containers
+// left out, in spec order.
+func podImages(p *corev1.Pod) string {
+	images := make([]string, 0, len(p.Spec.Containers))
+	for _, c := range p.Spec.Containers {
+		images = append(images, c.Image)
+	}
+	return strings.Join(images, ",")
+}
+
+// ownerKind is the kind of the pod's controller (its first owner when
+// none is marked controller), "none" for a standalone pod; ReplicaSets
+// found in rsOwner are replaced by their own controller's kind.
+func ownerKind(p *corev1.Pod, rsOwner map[string]string) string {
+	ref := metav1.GetControllerOf(p)
+	if ref == nil {
+		if len(p.OwnerReferences) == 0 {
+			return "none"
+		}
+		ref = &p.OwnerReferences[0]
+	}
+	if kind, ok := rsOwner[key(p.Namespace, ref.Name)]; ok && ref.Kind == "ReplicaSet" {
+		return kind
+	}
+	return ref.Kind
+}
+
+// controllerOf is the kind and name of the pod's controller, empty for
+// a standalone pod. A ReplicaSet loses its pod-template-hash suffix, so
+// the pods of every revision of a Deployment share one name.
+func controllerOf(p *corev1.Pod) (kind, name string) {
+	ref := metav1.GetControllerOf(p)
+	if ref == nil {
+		return "", ""
+	}
+	name = ref.Name
+	if h := p.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; ref.Kind == "ReplicaSet" && h != "" {
+		name = strings.TrimSuffix(name, "-"+h)
+	}
+	return ref.Kind, name
+}
+
+// collapsePods folds the pods of each controller into one row named
+// after it: metrics and restarts summed, READY as ready pods over pods,
+// STATUS counting pods per status ("9 Running, 1 Pending"). Text columns
+// the pods disagree on become "-", and so does P, unless they share a
+// node. Standalone pods keep their own row.
+func collapsePods(rows []podRow) []podRow {
+	type group struct {
+		row      podRow
+		n, ready int
+		statuses map[string]int
+	}
+	var out []podRow
+	var groups []*group
+	idx := map[string]*group{}
+	same := func(a, b string) string {
+		if a != b {
+			return "-"
+		}
+		return a
+	}
+	for _, r := range rows {
+		if r.ctrlName == "" {
+			out = append(out, r)
+			continue
+		}
+		k := key(r.ns, r.ctrlKind+"/"+r.ctrlName)
+		g := idx[k]
+		if g == nil {
+			g = &group{row: r, statuses: map[string]int{}}
+			g.row.name = r.ctrlName
+			g.row.vals = famMaps{}
+			for f, mp := range r.vals {
+				g.row.vals[f] = maps.Clone(mp)
+			}
+			idx[k] = g
+			groups = append(groups, g)
+		} else {
+			gr := &g.row
+			for f, mp := range r.vals {
+				for m, v := range mp {
+					if m != allocKey {
+						gr.vals[f][m] = add64(gr.vals[f][m], v)
+					}
+				}
+			}
+			if gr.node != r.node {
+				for _, mp := range gr.vals {
+					delete(mp, allocKey)
+				}
+			}
+			gr.node, gr.nodeStatus = same(gr.node, r.node), same(gr.nodeStatus, r.nodeStatus)
+			gr.ip, gr.images = same(gr.ip, r.ip), same(gr.images, r.images)
+			gr.reason, gr.scheduler = same(gr.reason, r.reason), same(gr.scheduler, r.scheduler)
+			gr.qos = same(gr.qos, r.qos)
+			gr.restarts = add64(gr.restarts, r.restarts)
+			if r.created.Before(gr.created) {
+				gr.created = r.created
+			}
+			if !r.started.IsZero() && (gr.started.IsZero() || r.started.Before(gr.started)) {
+				gr.started = r.started
+			}
+			if r.lastRestart.After(gr.lastRestart) {
+				gr.lastRestart = r.lastRestart
+			}
+			// the group is ready once its last pod is
+			if r.readySince.IsZero() || gr.readySince.IsZero() {
+				gr.readySince = time.Time{}
+			} else if r.readySince.After(gr.readySince) {
+				gr.readySince = r.readySince
+			}
+		}
+		g.n++
+		g.statuses[r.status]++
+		if ready, total, _ := strings.Cut(r.ready, "/"); ready == total {
+			g.ready++
+		}
+	}
+	for _, g := range groups {
+		statuses := slices.Collect(maps.Keys(g.statuses))
+		sort.Slice(statuses, func(i, j int) bool {
+			a, b := statuses[i], statuses[j]
+			if g.statuses[a] != g.statuses[b] {
+				return g.statuses[a] > g.statuses[b]
+			}
+			return a < b
+		})
+		for i, s := range statuses {
+			statuses[i] = fmt.Sprintf("%d %s", g.statuses[s], s)
+		}
+		g.row.ready = fmt.Sprintf("%d/%d", g.ready, g.n)
+		g.row.status = strings.Join(statuses, ", ")
+		out = append(out, g.row)
+	}
+	return out
+}
+
+// podPhase is the pod's phase; a pod whose kubelet stopped reporting may
+// carry none at all, which is shown as Unknown like the phase itself.
+func podPhase(p *corev1.Pod) string {
+	if p.Status.Phase == "" {
+		return string(corev1.PodUnknown)
+	}
+	return string(p.Status.Phase)
+}
+
+func newMetricMap(metrics []rune) map[rune]int64 {
+	m := make(map[rune]int64, len(metrics))
+	for _, k := range metrics {
+		m[k] = -1
+	}
+	return m
+}
+
+// famMaps holds a row's metric map per family letter.
+type famMaps map[rune]map[rune]int64
+
+// newFamMaps has a map for every family of the set, enabled or not, so
+// collectors can fill any of them without checking.
+func (t famSet) newFamMaps(metrics []rune) famMaps {
+	fm := make(famMaps, len(t))
+	for _, f := range t {
+		fm[f.letter] = newMetricMap(metrics)
+	}
+	return fm
+}
+
+func collectPods(ctx context.Context, k *kube, curNS string, all bool,
+	cfg columnCfg, fam rune, metric rune, rev bool) ([]podRow, error) {
+
+	nsSel := curNS
+	if all {
+		nsSel = ""
+	}
+	opts := metav1.ListOptions{LabelSelector: cfg.labelSel, FieldSelector: cfg.fieldSel}
+	if cfg.nodeName != "" {
+		opts.FieldSelector = strings.Trim(cfg.fieldSel+",spec.nodeName="+cfg.nodeName, ",")
+	}
+	// pod metrics do not depend on the pod list, so both are in flight
+	// together
+	var podMetrics func(*corev1.PodList) (*metricsv1beta1.PodMetricsList, error)
+	if containsRune(cfg.metrics, 'u') && k.metrics != nil {
+		podMetrics = k.podMetricsAsync(ctx, nsSel)
+	}
+	pods, err := k.listPods(ctx, nsSel, opts)
+	if apierrors.IsBadRequest(err) && cfg.nodeName != "" {
+		// an API server that does not index spec.nodeName: filter here
+		k.debug.printf("spec.nodeName selector rejected, filtering client-side: %v", err)
+		opts.FieldSelector = cfg.fieldSel
+		pods, err = k.listPods(ctx, nsSel, opts)
+		if err == nil {
+			pods.Items = slices.DeleteFunc(pods.Items, func(p corev1.Pod) bool { return p.Spec.NodeName != cfg.nodeName })
+		}
+	}
+	if apierrors.IsBadRequest(err) && cfg.fieldSel != "" {
+		// pods only index a few fields: metadata.name, metadata.namespace,
+		// spec.nodeName, spec.schedulerName, spec.serviceAccountName,
+		// status.phase, status.podIP, status.nominatedNodeName
+		return nil, fmt.Errorf("--field-selector %s is not supported for pods: %w", cfg.fieldSel, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	usageMap := map[string]struct{ mem, cpu int64 }{}
+	if podMetrics != nil {
+		if list, err := podMetrics(pods); err == nil {
+			for _, pm := range list.Items {
+				var mSum, cSum int64
+				for _, c := range pm.Containers {
+					if systemContainer(c.Name, cfg) {
+						continue
+					}
+					mSum += c.Usage.Memory().Value()
+					cSum += cfg.table.cpuUsage(c.Usage.Cpu())
+				}
+				usageMap[key(pm.Namespace, pm.Name)] = struct{ mem, cpu int64 }{mSum, cSum}
+			}
+		}
+	}
+
+	var pending pendingInfo
+	if cfg.explain {
+		pending = fetchPendingInfo(ctx, k, nsSel, pods.Items)
+	}
+
+	var nodeStatuses map[string]string
+	nodeAlloc := map[string]famMaps{} // P, allocatable under allocKey
+	withAlloc := containsRune(cfg.metrics, 'P')
+	if cfg.nodeStat || cfg.orphans || withAlloc {
+		nodes, err := k.listNodes(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		nodeStatuses = make(map[string]string, len(nodes.Items))
+		for i, n := range nodes.Items {
+			nodeStatuses[n.Name] = nodeStatus(&nodes.Items[i])
+			alloc := famMaps{}
+			for _, f := range cfg.table {
+				alloc[f.letter] = map[rune]int64{allocKey: f.listValue(n.Status.Allocatable)}
+			}
+			nodeAlloc[n.Name] = alloc
+		}
+	}
+
+	// --owner Deployment looks through each ReplicaSet to its owner
+	var rsOwner map[string]string // ns/replicaset -> controller kind
+	if strings.EqualFold(cfg.ownerKind, "Deployment") {
+		rss, err := k.listReplicaSets(ctx, nsSel)
+		if err != nil {
+			return nil, err
+		}
+		rsOwner = make(map[string]string, len(rss.Items))
+		for _, rs := range rss.Items {
+			if ref := metav1.GetControllerOf(&rs); ref != nil {
+				rsOwner[key(rs.Namespace, rs.Name)] = ref.Kind
+			}
+		}
+	}
+
+	var rows []podRow
+	for _, p := range pods.Items {
+		if all && cfg.excludeNS[p.Namespace] {
+			continue
+		}
+		if cfg.ownerKind != "" && !strings.EqualFold(ownerKind(&p, rsOwner), cfg.ownerKind) {
+			continue
+		}
+		sched := p.Spec.SchedulerName
+		if sched == "" {
+			sched = corev1.DefaultSchedulerName
+		}
+		if cfg.schedFilter != "" && sched != cfg.schedFilter {
+			continue
+		}
+		if cfg.orphans && (p.Spec.NodeName == "" || nodeStatuses[p.Spec.NodeName] != "") {
+			continue
+		}
+		r := podRow{
+			ns:        p.Namespace,
+			name:      p.Name,
+			status:    podPhase(&p),
+			node:      p.Spec.NodeName,
+			ip:        p.Status.PodIP,
+			scheduler: sched,
+			created:   p.CreationTimestamp.Time,
+			vals:      cfg.table.newFamMaps(cfg.metrics),
+		}
+		if p.Status.StartTime != nil {
+			r.started = p.Status.StartTime.Time
+		}
+		r.ready = readyCount(&p)
+		if cfg.wide {
+			r.images = podImages(&p)
+		}
+		if cfg.ages {
+			r.readySince, r.lastRestart = podTimes(&p)
+		}
+		if cfg.restarts {
+			r.restarts = restartCount(&p)
+		}
+		if cfg.qos {
+			r.qos = string(p.Status.QOSClass)
+		}
+		if cfg.explain {
+			r.reason = pending.classify(&p)
+		}
+		if cfg.wideStat {
+			r.status = podStatus(&p)
+		}
+		if cfg.nodeStat {
+			r.nodeStatus = "-"
+			if p.Spec.NodeName != "" {
+				r.nodeStatus = nodeStatuses[p.Spec.NodeName]
+			}
+			if r.nodeStatus == "" {
+				r.nodeStatus = "Missing" // bound to a node that is gone
+			}
+		}
+		addPodResources(r.vals, &p, "rl", cfg)
+		if uDat, ok := usageMap[key(p.Namespace, p.Name)]; ok {
+			r.vals['m']['u'] = uDat.mem
+			r.vals['c']['u'] = uDat.cpu
+		}
+		if a, ok := nodeAlloc[p.Spec.NodeName]; ok && withAlloc {
+			for f, mp := range a {
+				r.vals[f][allocKey] = mp[allocKey]
+			}
+		}
+		if cfg.collapse {
+			r.ctrlKind, r.ctrlName = controllerOf(&p)
+		}
+		rows = append(rows, r)
+	}
+	if cfg.collapse {
+		rows = collapsePods(rows)
+	}
+
+	if cfg.missing {
+		rows = slices.DeleteFunc(rows, func(r podRow) bool { return !usageMissing(r.vals, cfg) })
+	}
+	if cfg.bounded {
+		rows = slices.DeleteFunc(rows, func(r podRow) bool { return !inBounds(r.vals, fam, metric, cfg) })
+	}
+	k.debug.printf("pods: %d listed, usage for %d, %d rows after filters", len(pods.Items), len(usageMap), len(rows))
+
+	sortPods(rows, cfg, fam, metric, rev)
+	for _, r := range rows {
+		k.checkFailOver(r.vals, cfg)
+		k.noteUsage(r.vals, cfg)
+	}
+
+	return rows, nil
+}
+
+// sortPods orders rows as the pods table lists them: by the sort key,
+// flipped by -r, ties by namespace and name; namespaces first with
+// --group-by-namespace. The nodes drill-down uses it too.
+func sortPods(rows []podRow, cfg columnCfg, fam, metric rune, rev bool) {
+	less := func(a, b podRow) bool {
+		if cfg.groupNS && a.ns != b.ns {
+			return a.ns < b.ns
+		}
+		if metric == ageKey {
+			return ageLess(a.since(cfg), b.since(cfg), rev)
+		}
+		if rev {
+			a, b = b, a
+		}
+		return podLess(a, b, fam, metric, cfg.metrics)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return tieLess(less(rows[i], rows[j]), less(rows[j], rows[i]),
+			key(rows[i].ns, rows[i].name), key(rows[j].ns, rows[j].name))
+	})
+}
+
+// readyCount renders READY as kubectl does: ready containers over the
+// containers in the spec, 0/N before any status is reported.
+func readyCount(p *corev1.Pod) string {
+	ready := 0
+	for _, cs := range p.Status.ContainerStatuses {
+		if cs.Ready {
+			ready++
+		}
+	}
+	return fmt.Sprintf("%d/%d", ready, len(p.Spec.Containers))
+}
+
+// restartCount sums the restarts of the pod's containers; -1 when the
+// kubelet has not reported any container status yet.
+func restartCount(p *corev1.Pod) int64 {
+	if len(p.Status.ContainerStatuses) == 0 {
+		return -1
+	}
+	var n int64
+	for _, cs := range p.Status.ContainerStatuses {
+		n += int64(cs.RestartCount)
+	}
+	return n
+}
+
+// podReady reports whether the pod's Ready condition is True.
+func podReady(p *corev1.Pod) bool {
+	for _, c := range p.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// podTimes returns when the pod last became Ready and when any of its
+// containers last restarted.
+func podTimes(p *corev1.Pod) (readySince, lastRestart time.Time) {
+	for _, c := range p.Status.Conditions {
+		if c.Type == corev1.PodReady && c.Status == corev1.ConditionTrue {
+			readySince = c.LastTransitionTime.Time
+		}
+	}
+	for _, cs := range p.Status.ContainerStatuses {
+		if cs.RestartCount == 0 {
+			continue
+		}
+		t := time.Time{}
+		if cs.State.Running != nil {
+			t = cs.State.Running.StartedAt.Time
+		} else if cs.LastTerminationState.Terminated != nil {
+			t = cs.LastTerminationState.Terminated.FinishedAt.Time
+		}
+		if t.After(lastRestart) {
+			lastRestart = t
+		}
+	}
+	return
+}
+
+// systemContainer reports whether a metrics entry is the sandbox (pause)
+// container some runtimes report as "POD"; it is not part of the pod spec,
+// so kubectl top and requests never include it.
+func systemContainer(name string, cfg columnCfg) bool {
+	return !cfg.sysCont && name == "POD"
+}
+
+func add64(a, b int64) int64 {
+	if a < 0 {
+		return b
+	}
+	if b < 0 {
+		return a
+	}
+	return a + b
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func podLess(a, b podRow, fam, metric rune, metrics []rune) bool {
+	switch metric {
+	case nameKey:
+		return a.name < b.name
+	case statusKey:
+		return a.status < b.status
+	case restartKey:
+		return a.restarts > b.restarts
+	}
+	return rowSortValue(a.vals, fam, metric, metrics) >
+		rowSortValue(b.vals, fam, metric, metrics)
+}
+
+// tieLess finishes a comparison from the sort key both ways round: rows
+// equal on it fall back to their names, so output is reproducible
+// between runs.
+func tieLess(aFirst, bFirst bool, aName, bName string) bool {
+	if aFirst != bFirst {
+		return aFirst
+	}
+	return aName < bName
+}
+
+// podColumn is an optional per-pod text column printed between STATUS
+// and the metric columns.
+type podColumn struct {
+	header string
+	value  func(podRow) string
+	ratio  func(podRow) float64 // --color: nil for a column never colored
+}
+
+func podInfoColumns(cfg columnCfg) []podColumn {
+	var cols []podColumn
+	if cfg.explain {
+		cols = append(cols, podColumn{"REASON", func(r podRow) string { return r.reason }, nil})
+	}
+	if cfg.sched {
+		cols = append(cols, podColumn{"SCHEDULER", func(r podRow) string { return r.scheduler }, nil})
+	}
+	if cfg.showNode {
+		cols = append(cols, podColumn{"NODE", func(r podRow) string { return r.node }, nil})
+	}
+	if cfg.nodeStat {
+		cols = append(cols, podColumn{"NODE-STATUS", func(r podRow) string { return r.nodeStatus }, nodeStatusRatio})
+	}
+	if cfg.qos {
+		cols = append(cols, podColumn{"QOS", func(r podRow) string { return orDash(r.qos) }, nil})
+	}
+	if cfg.restarts {
+		cols = append(cols, podColumn{"RESTARTS", func(r podRow) string {
+			if r.restarts < 0 {
+				return "-"
+			}
+			return strconv.FormatInt(r.restarts, 10)
+		}, nil})
+	}
+	return cols
+}
+
+// nodeStatusRatio colors NODE-STATUS like a cell over critPct when the
+// pod's node is not Ready or no longer exists.
+func nodeStatusRatio(r podRow) float64 {
+	if strings.HasPrefix(r.nodeStatus, "NotReady") || r.nodeStatus == "Missing" {
+		return math.Inf(1)
+	}
+	return -1
+}
+
+// cell is c's text for r, colored when c has a ratio.
+func (c podColumn) cell(cfg columnCfg, r podRow) string {
+	s := truncate(c.value(r), cfg.cellMax)
+	if c.ratio == nil {
+		return s
+	}
+	return colorCell(cfg, s, c.ratio(r))
+}
+
+func printPods(w io.Writer, rows []podRow, cfg columnCfg, all bool, fam rune, u unitCfg) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	hw := headerWriter(tw, cfg)
+
+	if all {
+		fmt.Fprint(hw, "NAMESPACE\t")
+	}
+	fmt.Fprint(hw, "NAME\tREADY\tSTATUS\t")
+	info := podInfoColumns(cfg)
+	for _, c := range info {
+		if c.ratio != nil {
+			fmt.Fprintf(hw, "%s\t", colorCell(cfg, c.header, -1))
+		} else {
+			fmt.Fprintf(hw, "%s\t", c.header)
+		}
+	}
+	writeHeaders(hw, cfg, fam)
+	if cfg.ages {
+		fmt.Fprint(hw, "CREATED\tREADY-SINCE\tLAST-RESTART")
+	} else {
+		fmt.Fprint(hw, "AGE")
+	}
+	// like kubectl -o wide, after AGE; NODE once if n already shows it
+	wideNode := cfg.wide && !cfg.showNode
+	if cfg.wide {
+		fmt.Fprint(hw, "\tPOD-IP")
+	}
+	if wideNode {
+		fmt.Fprint(hw, "\tNODE")
+	}
+	if cfg.wide {
+		fmt.Fprint(hw, "\tIMAGES")
+	}
+	fmt.Fprintln(hw)
+
+	// sumRow prints TOTAL and the --group-by-namespace subtotals
+	sumRow := func(lead string, vals famMaps) {
+		fmt.Fprint(tw, lead)
+		for _, c := range info {
+			if c.ratio != nil {
+				fmt.Fprintf(tw, "%s\t", colorCell(cfg, "-", -1))
+			} else {
+				fmt.Fprint(tw, "-\t")
+			}
+		}
+		writeRowMetrics(tw, vals, cfg, fam, u)
+		if cfg.ages {
+			fmt.Fprint(tw, "-\t-\t")
+		}
+		fmt.Fprint(tw, "-")
+		if cfg.wide {
+			fmt.Fprint(tw, "\t-")
+		}
+		if wideNode {
+			fmt.Fprint(tw, "\t-")
+		}
+		if cfg.wide {
+			fmt.Fprint(tw, "\t-")
+		}
+		fmt.Fprintln(tw)
+	}
+
+	tot := cfg.table.newFamMaps(cfg.metrics)
+	sub := cfg.table.newFamMaps(cfg.metrics)
+
+	for i, r := range rows {
+		if all {
+			fmt.Fprintf(tw, "%s\t", r.ns)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t", truncate(r.name, cfg.cellMax), r.ready, r.status)
+		for _, c := range info {
+			fmt.Fprintf(tw, "%s\t", c.cell(cfg, r))
+		}
+		writeRowMetrics(tw, r.vals, cfg, fam, u)
+		if cfg.ages {
+			fmt.Fprintf(tw, "%s\t%s\t%s", ageFmt(r.created, cfg.age),
+				ageFmt(r.readySince, cfg.age), ageFmt(r.lastRestart, cfg.age))
+		} else {
+			fmt.Fprint(tw, ageFmt(r.since(cfg), cfg.age))
+		}
+		if cfg.wide {
+			fmt.Fprintf(tw, "\t%s", orDash(r.ip))
+		}
+		if wideNode {
+			fmt.Fprintf(tw, "\t%s", orDash(truncate(r.node, cfg.cellMax)))
+		}
+		if cfg.wide {
+			fmt.Fprintf(tw, "\t%s", orDash(truncate(r.images, cfg.cellMax)))
+		}
+		fmt.Fprintln(tw)
+
+		accumulateTotals(tot, r.vals)
+		if cfg.groupNS {
+			accumulateTotals(sub, r.vals)
+			if i == len(rows)-1 || rows[i+1].ns != r.ns {
+				sumRow(r.ns+"\tSUBTOTAL\t-\t-\t", sub)
+				sub = cfg.table.newFamMaps(cfg.metrics)
+			}
+		}
+	}
+
+	if cfg.total {
+		if all {
+			sumRow("TOTAL\t-\t-\t-\t", tot)
+		} else {
+			sumRow("TOTAL\t-\t-\t", tot)
+		}
+	}
+
+	tw.Flush()
+}
+
+/* ---------- helpers shared by all scopes ---------- */
+
+// headerWriter is where a table's header line goes: nowhere with
+// --no-headers, so scripts can read rows (and TOTAL) straight away.
+func headerWriter(tw io.Writer, cfg columnCfg) io.Writer {
+	if cfg.noHeader {
+		return io.Discard
+	}
+	return tw
+}
+
+// usageMissing reports whether usage was requested but is absent for
+// every enabled family of a row; u is dropped from the maps entirely
+// when metrics-server is unreachable.
+func usageMissing(vals famMaps, cfg columnCfg) bool {
+	for _, f := range cfg.table {
+		if !f.usage || !cfg.has(f.letter) {
+			continue
+		}
+		if v, ok := vals[f.letter]['u']; ok && v >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// inBounds applies --min/--max to the sort column; rows without a value
+// for it are dropped once a bound is set.
+func inBounds(vals famMaps, fam, metric rune, cfg columnCfg) bool {
+	mp := vals[fam]
+	if v, ok := mp[metric]; metric != 'd' && (!ok || v < 0) {
+		return false
+	}
+	v := sortValue(mp, metric, cfg.metrics)
+	return !math.IsInf(v, -1) && v >= cfg.minV && v <= cfg.maxV
+}
+
+// ageLess orders newest first (oldest first when rev); rows without a
+// creation time go last in both directions.
+func ageLess(a, b time.Time, rev bool) bool {
+	if a.IsZero() || b.IsZero() {
+		return !a.IsZero() && b.IsZero()
+	}
+	if rev {
+		return a.Before(b)
+	}
+	return a.After(b)
+}
+
+func rowSortValue(vals famMaps, fam, metric rune, metrics []rune) float64 {
+	if metric == scoreKey {
+		return scoreValue(vals)
+	}
+	return sortValue(vals[fam], metric, metrics)
+}
+
+// scoreValue is the tighter of the mem and cpu usage/requests ratios, so
+// one number ranks rows by overall utilisation; -1 when neither is known.
+func scoreValue(vals famMaps) float64 {
+	best := -1.0
+	for _, mp := range []map[rune]int64{vals['m'], vals['c']} {
+		if mp['u'] >= 0 && mp['r'] > 0 {
+			best = math.Max(best, float64(mp['u'])/float64(mp['r']))
+		}
+	}
+	return best
+}
+
+// costValue prices the requests of every family named in cfg.cost: cpu per
+// core, memory and ephemeral storage per GiB, --resource families per
+// unit; -1 when none of them is known.
+func costValue(vals famMaps, cfg columnCfg) float64 {
+	sum, priced := 0.0, false
+	for _, f := range cfg.table {
+		price, ok := cfg.cost[string(f.resource)]
+		if !ok || vals[f.letter]['r'] < 0 {
+			continue
+		}
+		n := float64(vals[f.letter]['r']) * math.Pow10(int(f.scale))
+		if f.resource == corev1.ResourceMemory || f.resource == corev1.ResourceEphemeralStorage {
+			n /= 1 << 30
+		}
+		sum, priced = sum+n*price, true
+	}
+	if !priced {
+		return -1
+	}
+	return sum
+}
+
+// sortValue is the comparable value of metric in one family map;
+// derived columns are computed on the fly, absent values sort last.
+func sortValue(mp map[rune]int64, metric rune, metrics []rune) float64 {
+	switch metric {
+	case 'p':
+		return percentValue(mp, metrics)
+	case 'd':
+		if d, ok := deltaValue(mp); ok {
+			return float64(d)
+		}
+		return math.Inf(-1)
+	case 'b':
+		if x, ok := ratioValue(mp); ok {
+			return x
+		}
+		return -1
+	case 'P':
+		return allocShare(mp, metrics, slices.Index(metrics, 'P'))
+	}
+	return float64(mp[metric])
+}
+
+// allocLetter is the column the P at cols[i] relates to allocatable:
+// the numeric one printed just before it, the first one when P leads;
+// 0 for none.
+func allocLetter(cols []rune, i int) rune {
+	var last rune
+	for j, m := range cols {
+		if isDerived(m) {
+			continue
+		}
+		if j > i {
+			if last == 0 {
+				last = m
+			}
+			break
+		}
+		last = m
+	}
+	return last
+}
+
+// allocShare is the P at cols[i]: the allocLetter column as a share of
+// the pod's node, or the node's own, allocatable; -1 when either is
+// unknown, e.g. for pods not scheduled yet or a node reporting no
+// allocatable.
+func allocShare(mp map[rune]int64, cols []rune, i int) float64 {
+	m := allocLetter(cols, i)
+	alloc, ok := mp[allocKey]
+	if m == 0 || !ok || mp[m] < 0 || alloc <= 0 {
+		return -1
+	}
+	return float64(mp[m]) / float64(alloc)
+}
+
+// percentValue sorts by the first p of the flags, dividing the same two
+// columns it prints; later p letters only add columns.
+func percentValue(mp map[rune]int64, metrics []rune) float64 {
+	x, y := pctOperands(mp, metrics, slices.Index(metrics, 'p'))
+	if x <= 0 || y <= 0 {
+		return -1
+	}
+	return float64(x) / float64(y)
+}
+
+func writeHeaders(tw io.Writer, cfg columnCfg, fam rune) {
+	short := map[rune]string{
+		'r': "REQ", 'l': "LIM", 'u': "USE",
+		'f': "FREE", 't': "TOTAL", 'd': "DELTA", 'b': "RATIO",
+		's': "RESERVED", 'o': "PODLIM", 'T': "CAP",
+	}
+
+	renderFam := func(f rune) {
+		prefix := cfg.table.of(f).prefix
+		if cfg.storage {
+			prefix = "STORAGE_"
+		}
+
+		for _, i := range cfg.order() {
+			m := cfg.metrics[i]
+			if m == 'p' {
+				lbl := "PCT"
+				if x, y := pctLetters(cfg.metrics, i); y != 0 {
+					lbl = short[x] + "_" + short[y]
+				}
+				fmt.Fprintf(tw, "%s\t", colorCell(cfg, prefix+lbl, -1))
+				continue
+			}
+			if m == 'P' {
+				lbl := "PCT"
+				if x := allocLetter(cfg.metrics, i); x != 0 {
+					lbl = short[x]
+				}
+				fmt.Fprintf(tw, "%s\t", colorCell(cfg, prefix+lbl+"_ALLOC", -1))
+				continue
+			}
+			if m == 'f' {
+				fmt.Fprintf(tw, "%s\t", colorCell(cfg, prefix+short[m], -1))
+				continue
+			}
+			fmt.Fprintf(tw, "%s%s\t", prefix, short[m])
+		}
+	}
+
+	for _, f := range cfg.families(fam) {
+		renderFam(f)
+	}
+	if cfg.score {
+		fmt.Fprintf(tw, "%s\t", colorCell(cfg, "SCORE", -1))
+	}
+	if cfg.cost != nil {
+		fmt.Fprint(tw, "COST\t")
+	}
+}
+
+// ANSI codes for --color. Every cell of a colored column, header and
+// plain ones included, carries a code pair of the same length, so
+// tabwriter, which counts the escape bytes as text, still lines up.
+const (
+	ansiDefault = "\x1b[39m"
+	ansiYellow  = "\x1b[33m"
+	ansiRed     = "\x1b[31m"
+	ansiReset   = "\x1b[0m"
+)
+
+// colorCell wraps s for --color: red over critPct, yellow over warnPct;
+// ratio is a fraction, negative when unknown.
+func colorCell(cfg columnCfg, s string, ratio float64) string {
+	if !cfg.color {
+		return s
+	}
+	code := ansiDefault
+	switch {
+	case ratio*100 > cfg.critPct:
+		code = ansiRed
+	case ratio*100 > cfg.warnPct:
+		code = ansiYellow
+	}
+	return code + s + ansiReset
+}
+
+func writeRowMetrics(tw io.Writer, vals famMaps,
+	cfg columnCfg, fam rune, u unitCfg) {
+
+	render := func(f rune, mp map[rune]int64) {
+		for _, i := range cfg.order() {
+			m := cfg.metrics[i]
+			if m == 'p' {
+				x, y := pctOperands(mp, cfg.metrics, i)
+				ratio := -1.0
+				if x > 0 && y > 0 {
+					ratio = float64(x) / float64(y)
+				}
+				fmt.Fprintf(tw, "%s\t", colorCell(cfg, pct(x, y), ratio))
+				continue
+			}
+
+			if m == 'd' {
+				if d, ok := deltaValue(mp); ok {
+					fmt.Fprintf(tw, "%s\t", signed(d, cfg.table.of(f).format(abs64(d), u)))
+				} else {
+					fmt.Fprint(tw, "-\t")
+				}
+				continue
+			}
+
+			if m == 'P' {
+				if x := allocShare(mp, cfg.metrics, i); x >= 0 {
+					fmt.Fprintf(tw, "%s\t", colorCell(cfg, fmt.Sprintf("%.0f%%", x*100), x))
+				} else {
+					fmt.Fprintf(tw, "%s\t", colorCell(cfg, "-", -1))
+				}
+				continue
+			}
+
+			if m == 'b' {
+				if x, ok := ratioValue(mp); ok {
+					fmt.Fprintf(tw, "%.1fx\t", x)
+				} else {
+					fmt.Fprint(tw, "-\t")
+				}
+				continue
+			}
+
+			val := mp[m]
+			cell := "-"
+			if val >= 0 {
+				cell = cfg.table.of(f).format(val, u)
+			}
+			if m == 'f' {
+				// free is colored by the used share of allocatable
+				used := -1.0
+				if val >= 0 && mp['l'] > 0 {
+					used = 1 - float64(val)/float64(mp['l'])
+				}
+				cell = colorCell(cfg, cell, used)
+			}
+			fmt.Fprintf(tw, "%s\t", cell)
+		}
+	}
+
+	for _, f := range cfg.families(fam) {
+		render(f, vals[f])
+	}
+	if cfg.score {
+		if sc := scoreValue(vals); sc >= 0 {
+			fmt.Fprintf(tw, "%s\t", colorCell(cfg, fmt.Sprintf("%.0f%%", sc*100), sc))
+		} else {
+			fmt.Fprintf(tw, "%s\t", colorCell(cfg, "-", -1))
+		}
+	}
+	if cfg.cost != nil {
+		if c := costValue(vals, cfg); c >= 0 {
+			fmt.Fprintf(tw, "%.2f\t", c)
+		} else {
+			fmt.Fprint(tw, "-\t")
+		}
+	}
+}
+
+// pctLetters are the two numeric columns the p at cols[i] divides, the
+// first over the second: the two printed just before it, else the row's
+// first two; 0 where there is no such column. Headers and values both
+// come from here, so the label always names what is divided.
+func pctLetters(cols []rune, i int) (x, y rune) {
+	var before, all []rune
+	for j, m := range cols {
+		if isDerived(m) {
+			continue
+		}
+		if j < i {
+			before = append(before, m)
+		}
+		all = append(all, m)
+	}
+	switch {
+	case len(before) >= 2:
+		return before[len(before)-2], before[len(before)-1]
+	case len(all) >= 2:
+		return all[0], all[1]
+	case len(all) == 1:
+		return all[0], 0
+	}
+	return 0, 0
+}
+
+// pctOperands are the values pctLetters names, -1 for a missing column.
+func pctOperands(mp map[rune]int64, cols []rune, i int) (x, y int64) {
+	a, b := pctLetters(cols, i)
+	x, y = -1, -1
+	if a != 0 {
+		x = mp[a]
+	}
+	if b != 0 {
+		y = mp[b]
+	}
+	return x, y
+}
+
+// runStats is what the collectors of one run note for Main: failedOver
+// once a row breaks --fail-over, which exits 2 after printing; the rows
+// of a render that want usage and the ones that got none, with
+// usageWarned keeping the warning to one per run.
+type runStats struct {
+	failedOver              bool
+	usageRows, usageMissing int
+	usageWarned             bool
+}
+
+// checkFailOver looks at every p and P of every enabled family of a row.
+func (k *kube) checkFailOver(vals famMaps, cfg columnCfg) {
+	if cfg.failOver <= 0 {
+		return
+	}
+	for _, f := range cfg.fams {
+		mp := vals[f]
+		for i, m := range cfg.metrics {
+			ratio := -1.0
+			switch m {
+			case 'p':
+				if x, y := pctOperands(mp, cfg.metrics, i); x > 0 && y > 0 {
+					ratio = float64(x) / float64(y)
+				}
+			case 'P':
+				ratio = allocShare(mp, cfg.metrics, i)
+			}
+			if ratio*100 > cfg.failOver {
+				k.debug.printf("--fail-over: %c %c at %.0f%%", f, m, ratio*100)
+				k.stats.failedOver = true
+			}
+		}
+	}
+}
+
+func (k *kube) noteUsage(vals famMaps, cfg columnCfg) {
+	if !containsRune(cfg.metrics, 'u') && !containsRune(cfg.metrics, 'f') || cfg.quotaView() {
+		return
+	}
+	k.stats.usageRows++
+	if usageMissing(vals, cfg) {
+		k.stats.usageMissing++
+	}
+}
+
+// warnEmptyUsage tells on stderr when no row of the last render had
+// usage, so blank u, p and f columns are not taken for zero use.
+func (k *kube) warnEmptyUsage() {
+	s := &k.stats
+	if !s.usageWarned && s.usageRows > 0 && s.usageMissing == s.usageRows {
+		log.Print("warning: no row has usage data (is metrics-server ready?), usage columns are empty")
+		s.usageWarned = true
+	}
+	s.usageRows, s.usageMissing = 0, 0
+}
+
+func accumulateTotals(tot, add famMaps) {
+	for f, mp := range add {
+		for k, v := range mp {
+			if v < 0 || k == allocKey {
+				continue
+			}
+			if tot[f][k] < 0 {
+				tot[f][k] = 0
+			}
+			tot[f][k] += v
+		}
+	}
+}
+
+/* ---------- nodes ---------- */
+
+type nodeRow struct {
+	name, status string
+	ip           string // --wide: InternalIP
+	roles        string // --wide: from node-role.kubernetes.io/* labels
+	created      time.Time
+	vals         famMaps
+	pods         []podRow // --top-pods-per-node, already sorted and cut
+
+	podCount, notReady int64 // --pod-counts
+}
+
+func collectNodes(ctx context.Context, k *kube, cfg columnCfg, fam rune,
+	metric rune, rev bool) ([]nodeRow, error) {
+
+	// the node list, the pod list and node metrics are independent, so
+	// they are fetched together; results are only read after wg.Wait
+	wantUsage := (containsRune(cfg.metrics, 'u') || containsRune(cfg.metrics, 'f')) && k.metrics != nil
+	var (
+		wg          sync.WaitGroup
+		pods        *corev1.PodList
+		nodeMetrics *metricsv1beta1.NodeMetricsList
+		nmErr       error
+		allNodes    *corev1.NodeList // -l with --show-orphans
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		pods, _ = k.listPods(ctx, "", metav1.ListOptions{})
+	}()
+	if wantUsage {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nodeMetrics, nmErr = k.listNodeMetrics(ctx)
+		}()
+	}
+	if cfg.orphans && cfg.labelSel != "" {
+		// pods run on nodes that -l leaves out too; only the full list
+		// tells those from nodes that are really gone
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			allNodes, _ = k.listNodes(ctx, metav1.ListOptions{})
+		}()
+	}
+	nodes, err := k.listNodes(ctx, metav1.ListOptions{LabelSelector: cfg.labelSel})
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	// rows is preallocated so the idx pointers stay valid
+	idx := map[string]*nodeRow{}
+	rows := make([]nodeRow, 0, len(nodes.Items))
+
+	for _, n := range nodes.Items {
+		r := nodeRow{
+			name:    n.Name,
+			status:  nodeStatus(&n),
+			ip:      internalIP(&n),
+			roles:   nodeRoles(&n),
+			created: n.CreationTimestamp.Time,
+			vals:    cfg.table.newFamMaps(cfg.metrics),
+		}
+		for _, f := range cfg.table {
+			mp := r.vals[f.letter]
+			mp['l'] = f.listValue(n.Status.Allocatable)
+			if containsRune(cfg.metrics, 'P') {
+				mp[allocKey] = mp['l']
+			}
+			if containsRune(cfg.metrics, 's') {
+				// kube-reserved + system-reserved + eviction threshold
+				mp['s'] = reserved(f.listValue(n.Status.Capacity), mp['l'])
+			}
+			if containsRune(cfg.metrics, 'T') {
+				mp['T'] = f.listValue(n.Status.Capacity)
+			}
+		}
+		rows = append(rows, r)
+		idx[n.Name] = &rows[len(rows)-1]
+	}
+
+	// pods of nodes left out by -l are skipped, not taken for orphans
+	unselected := map[string]bool{}
+	if allNodes != nil {
+		for _, n := range allNodes.Items {
+			unselected[n.Name] = idx[n.Name] == nil
+		}
+	}
+	missing := func(node string) bool {
+		if node == "" || unselected[node] {
+			return false
+		}
+		return cfg.labelSel == "" || allNodes != nil
+	}
+
+	podNode := map[string]string{}
+	podIdx := map[string]podRow{} // --top-pods-per-node
+	var lost []*nodeRow           // --show-orphans
+	if pods != nil {
+		for _, p := range pods.Items {
+			nr := idx[p.Spec.NodeName]
+			if nr == nil && missing(p.Spec.NodeName) {
+				k.debug.printf("pod %s/%s is bound to missing node %s", p.Namespace, p.Name, p.Spec.NodeName)
+				if cfg.orphans {
+					nr = &nodeRow{
+						name:   p.Spec.NodeName,
+						status: "Missing",
+						vals:   cfg.table.newFamMaps(cfg.metrics),
+					}
+					idx[nr.name] = nr
+					lost = append(lost, nr)
+				}
+			}
+			if nr == nil {
+				continue
+			}
+			podNode[key(p.Namespace, p.Name)] = p.Spec.NodeName
+			nr.podCount++
+			if p.Status.Phase != corev1.PodSucceeded && !podReady(&p) {
+				nr.notReady++
+			}
+			var pr podRow
+			if cfg.topPods > 0 {
+				pr = podRow{
+					ns:      p.Namespace,
+					name:    p.Name,
+					status:  podPhase(&p),
+					created: p.CreationTimestamp.Time,
+					vals:    cfg.table.newFamMaps(cfg.metrics),
+				}
+				podIdx[key(p.Namespace, p.Name)] = pr
+			}
+			// l is allocatable on the node row; o sums the pod limits
+			addPodResources(nr.vals, &p, "r", cfg)
+			if containsRune(cfg.metrics, 'o') {
+				for f, mp := range podResources(&p, cfg) {
+					if mp['l'] >= 0 {
+						nr.vals[f]['o'] = add64(nr.vals[f]['o'], mp['l'])
+					}
+				}
+			}
+			if pr.vals != nil {
+				addPodResources(pr.vals, &p, "rl", cfg)
+				for f, mp := range pr.vals {
+					mp[allocKey] = nr.vals[f][allocKey]
+				}
+				nr.pods = append(nr.pods, pr)
+			}
+		}
+	}
+
+	// node usage comes from NodeMetrics, which like kubectl top nodes
+	// includes system daemons and the kubelet; summing pod metrics is the
+	// fallback when the node list is not served
+	covered, nodeUsage := 0, false
+	if wantUsage {
+		if nmErr == nil {
+			for _, nm := range nodeMetrics.Items {
+				if nr := idx[nm.Name]; nr != nil {
+					nr.vals['m']['u'] = nm.Usage.Memory().Value()
+					nr.vals['c']['u'] = cfg.table.cpuUsage(nm.Usage.Cpu())
+				}
+			}
+			nodeUsage = true
+		} else {
+			k.debug.printf("node metrics unavailable, summing pod usage: %v", nmErr)
+		}
+	}
+	if wantUsage && (!nodeUsage || cfg.topPods > 0 || len(lost) > 0) {
+		if list, err := k.listPodMetrics(ctx, "", namespacesOf(pods)); err == nil {
+			for _, pm := range list.Items {
+				node := podNode[key(pm.Namespace, pm.Name)]
+				nr := idx[node]
+				if nr == nil {
+					continue
+				}
+				covered++
+				pr, tracked := podIdx[key(pm.Namespace, pm.Name)]
+				for _, c := range pm.Containers {
+					if systemContainer(c.Name, cfg) {
+						continue
+					}
+					if !nodeUsage || nr.status == "Missing" {
+						nr.vals['m']['u'] = add64(nr.vals['m']['u'], c.Usage.Memory().Value())
+						nr.vals['c']['u'] = add64(nr.vals['c']['u'], cfg.table.cpuUsage(c.Usage.Cpu()))
+					}
+					if tracked {
+						pr.vals['m']['u'] = add64(pr.vals['m']['u'], c.Usage.Memory().Value())
+						pr.vals['c']['u'] = add64(pr.vals['c']['u'], cfg.table.cpuUsage(c.Usage.Cpu()))
+					}
+				}
+			}
+		}
+	}
+
+	for _, nr := range lost {
+		rows = append(rows, *nr)
+	}
+
+	for _, nr := range rows {
+		for _, mp := range nr.vals {
+			if containsRune(cfg.metrics, 'f') && mp['l'] >= 0 && mp['u'] >= 0 {
+				mp['f'] = mp['l'] - mp['u']
+			}
+			if containsRune(cfg.metrics, 't') {
+				mp['t'] = mp['l']
+			}
+		}
+	}
+
+	if cfg.missing {
+		rows = slices.DeleteFunc(rows, func(r nodeRow) bool { return !usageMissing(r.vals, cfg) })
+	}
+	if cfg.bounded {
+		rows = slices.DeleteFunc(rows, func(r nodeRow) bool { return !inBounds(r.vals, fam, metric, cfg) })
+	}
+	k.debug.printf("nodes: %d listed, %d pods placed, usage for %d, %d rows after filters",
+		len(nodes.Items), len(podNode), covered, len(rows))
+
+	less := func(a, b nodeRow) bool {
+		if metric == ageKey {
+			return ageLess(a.created, b.created, rev)
+		}
+		if rev {
+			a, b = b, a
+		}
+		return nodeLess(a, b, fam, metric, cfg.metrics)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return tieLess(less(rows[i], rows[j]), less(rows[j], rows[i]), rows[i].name, rows[j].name)
+	})
+
+	for i := range rows {
+		top := rows[i].pods
+		sortPods(top, cfg, fam, metric, rev)
+		if len(top) > cfg.topPods {
+			rows[i].pods = top[:cfg.topPods]
+		}
+	}
+	for _, r := range rows {
+		k.checkFailOver(r.vals, cfg)
+		k.noteUsage(r.vals, cfg)
+	}
+
+	return rows, nil
+}
+
+// podResources is the pod's effective requests and limits per family as
+// the scheduler counts them: per resource, the larger of the app
+// containers' sum and the biggest init container, which runs alone
+// before them, plus the RuntimeClass overhead (on limits only where a
+// limit is set). -1 when nothing sets the value. --all-containers sums
+// every container of the spec instead, init and ephemeral ones included.
+func podResources(p *corev1.Pod, cfg columnCfg) famMaps {
+	pr := cfg.table.newFamMaps([]rune("rl"))
+	for _, c := range specContainers(p, cfg) {
+		addContainerResources(pr, c.Resources, cfg.table)
+	}
+	for _, c := range p.Spec.InitContainers {
+		if cfg.allConts {
+			break // already summed
+		}
+		ir := cfg.table.newFamMaps([]rune("rl"))
+		addContainerResources(ir, c.Resources, cfg.table)
+		for f, mp := range pr {
+			for _, m := range "rl" {
+				mp[m] = max(mp[m], ir[f][m])
+			}
+		}
+	}
+	for _, f := range cfg.table {
+		if q, ok := p.Spec.Overhead[f.resource]; ok {
+			mp := pr[f.letter]
+			mp['r'] = add64(mp['r'], f.quantityValue(q))
+			if mp['l'] >= 0 {
+				mp['l'] += f.quantityValue(q)
+			}
+		}
+	}
+	return pr
+}
+
+// addPodResources adds the pod's effective values of the given letters
+// (r, l) to a row's family maps.
+func addPodResources(vals famMaps, p *corev1.Pod, letters string, cfg columnCfg) {
+	for f, mp := range podResources(p, cfg) {
+		for _, m := range letters {
+			if mp[m] >= 0 {
+				vals[f][m] = add64(vals[f][m], mp[m])
+			}
+		}
+	}
+}
+
+// specContainers are the pod's app containers, followed with
+// --all-containers by its init and ephemeral ones.
+func specContainers(p *corev1.Pod, cfg columnCfg) []corev1.Container {
+	if !cfg.allConts {
+		return p.Spec.Containers
+	}
+	cs := slices.Concat(p.Spec.Containers, p.Spec.InitContainers)
+	for _, ec := range p.Spec.EphemeralContainers {
+		cs = append(cs, corev1.Container(ec.EphemeralContainerCommon))
+	}
+	return cs
+}
+
+// addContainerResources adds one container's requests and limits to a
+// pod's family maps.
+func addContainerResources(vals famMaps, res corev1.ResourceRequirements, t famSet) {
+	for _, f := range t {
+		if q, ok := res.Requests[f.resource]; ok {
+			vals[f.letter]['r'] = add64(vals[f.letter]['r'], f.quantityValue(q))
+		}
+		if q, ok := res.Limits[f.resource]; ok {
+			vals[f.letter]['l'] = add64(vals[f.letter]['l'], f.quantityValue(q))
+		}
+	}
+}
+
+// nodeStatus is Ready or NotReady, with ",SchedulingDisabled" appended
+// for a cordoned node as kubectl get nodes does.
+func nodeStatus(n *corev1.Node) string {
+	status := "NotReady"
+	for _, c := range n.Status.Conditions {
+		if c.Type == corev1.NodeReady && c.Status == corev1.ConditionTrue {
+			status = "Ready"
+			break
+		}
+	}
+	cordoned := n.Spec.Unschedulable
+	for _, t := range n.Spec.Taints {
+		if t.Key == corev1.TaintNodeUnschedulable {
+			cordoned = true
+		}
+	}
+	if cordoned {
+		status += ",SchedulingDisabled"
+	}
+	return status
+}
+
+// reserved is capacity minus allocatable, or -1 when the node does not
+// report a capacity.
+func reserved(capacity, allocatable int64) int64 {
+	if capacity <= 0 || allocatable < 0 {
+		return -1
+	}
+	return capacity - allocatable
+}
+
+func nodeLess(a, b nodeRow, fam, metric rune, metrics []rune) bool {
+	switch metric {
+	case nameKey:
+		return a.name < b.name
+	case statusKey:
+		return a.status < b.status
+	}
+	return rowSortValue(a.vals, fam, metric, metrics) >
+		rowSortValue(b.vals, fam, metric, metrics)
+}
+
+// internalIP is the node's first InternalIP address, or "" without one.
+func internalIP(n *corev1.Node) string {
+	for _, a := range n.Status.Addresses {
+		if a.Type == corev1.NodeInternalIP {
+			return a.Address
+		}
+	}
+	return ""
+}
+
+// nodeRoles joins the roles of node-role.kubernetes.io/<role> labels and
+// the older kubernetes.io/role; a node without any is a worker.
+func nodeRoles(n *corev1.Node) string {
+	var roles []string
+	for k, v := range n.Labels {
+		if role, ok := strings.CutPrefix(k, "node-role.kubernetes.io/"); ok && role != "" {
+			roles = append(roles, role)
+		} else if k == "kubernetes.io/role" && v != "" {
+			roles = append(roles, v)
+		}
+	}
+	if len(roles) == 0 {
+		return "worker"
+	}
+	slices.Sort(roles)
+	return strings.Join(slices.Compact(roles), ",")
+}
+
+// allocTotals gives the nodes TOTAL row its P: the summed allocatable.
+func allocTotals(tot famMaps) {
+	for _, mp := range tot {
+		mp[allocKey] = mp['l']
+	}
+}
+
+func printNodes(w io.Writer, rows []nodeRow, cfg columnCfg, fam rune, u unitCfg) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	hw := headerWriter(tw, cfg)
+
+	fmt.Fprint(hw, "NAME\tSTATUS\t")
+	if cfg.podCount {
+		fmt.Fprint(hw, "POD_COUNT\tNOTREADY\t")
+	}
+	writeHeaders(hw, cfg, fam)
+	if cfg.wide {
+		fmt.Fprint(hw, "AGE\tINTERNAL-IP\tROLES\n")
+	} else {
+		fmt.Fprint(hw, "AGE\n")
+	}
+
+	tot := cfg.table.newFamMaps(cfg.metrics)
+	var totPods, totNotReady int64
+
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%s\t", truncate(r.name, cfg.cellMax), r.status)
+		if cfg.podCount {
+			fmt.Fprintf(tw, "%d\t%d\t", r.podCount, r.notReady)
+		}
+		writeRowMetrics(tw, r.vals, cfg, fam, u)
+		if cfg.wide {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", ageFmt(r.created, cfg.age), orDash(r.ip), orDash(r.roles))
+		} else {
+			fmt.Fprintf(tw, "%s\n", ageFmt(r.created, cfg.age))
+		}
+
+		// l on a node is allocatable, so the pod lines show pod limits
+		// under the same header
+		for _, p := range r.pods {
+			fmt.Fprintf(tw, "  %s\t%s\t", truncate(key(p.ns, p.name), cfg.cellMax), p.status)
+			if cfg.podCount {
+				fmt.Fprint(tw, "\t\t")
+			}
+			writeRowMetrics(tw, p.vals, cfg, fam, u)
+			if cfg.wide {
+				fmt.Fprintf(tw, "%s\t-\t-\n", ageFmt(p.created, cfg.age))
+			} else {
+				fmt.Fprintf(tw, "%s\n", ageFmt(p.created, cfg.age))
+			}
+		}
+
+		accumulateTotals(tot, r.vals)
+		totPods += r.podCount
+		totNotReady += r.notReady
+	}
+
+	if cfg.total {
+		allocTotals(tot)
+		fmt.Fprint(tw, "TOTAL\t-\t")
+		if cfg.podCount {
+			fmt.Fprintf(tw, "%d\t%d\t", totPods, totNotReady)
+		}
+		writeRowMetrics(tw, tot, cfg, fam, u)
+		if cfg.wide {
+			fmt.Fprint(tw, "-\t-\t-\n")
+		} else {
+			fmt.Fprint(tw, "-\n")
+		}
+	}
+
+	tw.Flush()
+}
+
+/* ---------- namespaces ---------- */
+
+type nsRow struct {
+	name, status string
+	created      time.Time
+	vals         famMaps
+	phases       phaseCounts // --pod-counts
+}
+
+// phaseCounts tallies pods by phase for --pod-counts; Succeeded and
+// Unknown pods are left out.
+type phaseCounts struct{ running, pending, failed int64 }
+
+func (c *phaseCounts) add(p corev1.PodPhase) {
+	switch p {
+	case corev1.PodRunning:
+		c.running++
+	case corev1.PodPending:
+		c.pending++
+	case corev1.PodFailed:
+		c.failed++
+	}
+}
+
+func collectNamespaces(ctx context.Context, k *kube, cfg columnCfg,
+	fam rune, metric rune, rev bool) ([]nsRow, error) {
+
+	list, err := k.listNamespaces(ctx, metav1.ListOptions{LabelSelector: cfg.labelSel})
+	if err != nil {
+		return nil, err
+	}
+
+	idx := map[string]*nsRow{}
+	rows := make([]nsRow, 0, len(list.Items)) // idx points into it
+
+	for _, n := range list.Items {
+		if cfg.excludeNS[n.Name] {
+			continue
+		}
+		r := nsRow{
+			name:    n.Name,
+			status:  string(n.Status.Phase),
+			created: n.CreationTimestamp.Time,
+			vals:    cfg.table.newFamMaps(cfg.metrics),
+		}
+		rows = append(rows, r)
+		idx[n.Name] = &rows[len(rows)-1]
+	}
+
+	if pods, _ := k.listPods(ctx, "", metav1.ListOptions{}); pods != nil {
+		for _, p := range pods.Items {
+			nr := idx[p.Namespace]
+			if nr == nil {
+				continue
+			}
+			letters := "rl"
+			if cfg.quotaView() {
+				letters = "r" // l is the quota's
+			}
+			addPodResources(nr.vals, &p, letters, cfg)
+			nr.phases.add(p.Status.Phase)
+		}
+	}
+
+	// t reads the ResourceQuotas: every quota of a namespace is enforced,
+	// so per resource the smallest hard requests.<resource> wins as t and
+	// its used as u, and the smallest hard limits.<resource> is l
+	if cfg.quotaView() {
+		if quotas, err := k.listResourceQuotas(ctx, ""); err == nil {
+			for _, q := range quotas.Items {
+				if nr := idx[q.Namespace]; nr != nil {
+					addQuota(nr.vals, &q, cfg.table)
+				}
+			}
+		} else {
+			k.debug.printf("resource quotas unavailable: %v", err)
+		}
+	}
+
+	covered := 0
+	if containsRune(cfg.metrics, 'u') && k.metrics != nil && !cfg.quotaView() {
+		names := make([]string, 0, len(rows))
+		for _, r := range rows {
+			names = append(names, r.name)
+		}
+		if lst, err := k.listPodMetrics(ctx, "", names); err == nil {
+			for _, pm := range lst.Items {
+				nr := idx[pm.Namespace]
+				if nr == nil {
+					continue
+				}
+				covered++
+				for _, c := range pm.Containers {
+					if systemContainer(c.Name, cfg) {
+						continue
+					}
+					nr.vals['m']['u'] = add64(nr.vals['m']['u'], c.Usage.Memory().Value())
+					nr.vals['c']['u'] = add64(nr.vals['c']['u'], cfg.table.cpuUsage(c.Usage.Cpu()))
+				}
+			}
+		}
+	}
+
+	if cfg.missing {
+		rows = slices.DeleteFunc(rows, func(r nsRow) bool { return !usageMissing(r.vals, cfg) })
+	}
+	if cfg.bounded {
+		rows = slices.DeleteFunc(rows, func(r nsRow) bool { return !inBounds(r.vals, fam, metric, cfg) })
+	}
+	k.debug.printf("namespaces: %d listed, usage for %d pods, %d rows after filters", len(list.Items), covered, len(rows))
+
+	less := func(a, b nsRow) bool {
+		if metric == ageKey {
+			return ageLess(a.created, b.created, rev)
+		}
+		if rev {
+			a, b = b, a
+		}
+		return nsLess(a, b, fam, metric, cfg.metrics)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return tieLess(less(rows[i], rows[j]), less(rows[j], rows[i]), rows[i].name, rows[j].name)
+	})
+	for _, r := range rows {
+		k.checkFailOver(r.vals, cfg)
+		k.noteUsage(r.vals, cfg)
+	}
+
+	return rows, nil
+}
+
+// addQuota folds one ResourceQuota into a namespace row. The status,
+// what the quota controller enforces, is read first; a quota it has not
+// synced yet falls back to its spec, with nothing used.
+func addQuota(vals famMaps, q *corev1.ResourceQuota, t famSet) {
+	hard := q.Status.Hard
+	if len(hard) == 0 {
+		hard = q.Spec.Hard
+	}
+	for _, f := range t {
+		mp := vals[f.letter]
+		for _, name := range []corev1.ResourceName{f.resource, "requests." + f.resource} {
+			qty, ok := hard[name]
+			if !ok {
+				continue
+			}
+			if v := f.quantityValue(qty); mp['t'] < 0 || v < mp['t'] {
+				mp['t'], mp['u'] = v, -1
+				if used, ok := q.Status.Used[name]; ok {
+					mp['u'] = f.quantityValue(used)
+				}
+			}
+		}
+		if qty, ok := hard["limits."+f.resource]; ok {
+			if v := f.quantityValue(qty); mp['l'] < 0 || v < mp['l'] {
+				mp['l'] = v
+			}
+		}
+	}
+}
+
+func nsLess(a, b nsRow, fam, metric rune, metrics []rune) bool {
+	switch metric {
+	case nameKey:
+		return a.name < b.name
+	case statusKey:
+		return a.status < b.status
+	}
+	return rowSortValue(a.vals, fam, metric, metrics) >
+		rowSortValue(b.vals, fam, metric, metrics)
+}
+
+func printNS(w io.Writer, rows []nsRow, cfg columnCfg, fam rune, u unitCfg) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	hw := headerWriter(tw, cfg)
+
+	fmt.Fprint(hw, "NAME\tSTATUS\t")
+	if cfg.podCount {
+		fmt.Fprint(hw, "RUNNING\tPENDING\tFAILED\t")
+	}
+	writeHeaders(hw, cfg, fam)
+	fmt.Fprint(hw, "AGE\n")
+
+	tot := cfg.table.newFamMaps(cfg.metrics)
+	var totPhases phaseCounts
+
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%s\t", truncate(r.name, cfg.cellMax), r.status)
+		if cfg.podCount {
+			fmt.Fprintf(tw, "%d\t%d\t%d\t", r.phases.running, r.phases.pending, r.phases.failed)
+		}
+		writeRowMetrics(tw, r.vals, cfg, fam, u)
+		fmt.Fprintf(tw, "%s\n", ageFmt(r.created, cfg.age))
+
+		accumulateTotals(tot, r.vals)
+		totPhases.running += r.phases.running
+		totPhases.pending += r.phases.pending
+		totPhases.failed += r.phases.failed
+	}
+
+	if cfg.total {
+		fmt.Fprint(tw, "TOTAL\t-\t")
+		if cfg.podCount {
+			fmt.Fprintf(tw, "%d\t%d\t%d\t", totPhases.running, totPhases.pending, totPhases.failed)
+		}
+		writeRowMetrics(tw, tot, cfg, fam, u)
+		fmt.Fprint(tw, "-\n")
+	}
+
+	tw.Flush()
+}
+
+/* ---------- containers ---------- */
+
+type containerRow struct {
+	ns, pod, name, node string
+	created             time.Time // of the pod
+	vals                famMaps
+}
+
+// collectContainers is collectPods without the per-pod sums: one row per
+// spec container, with usage taken from the matching PodMetrics entry.
+func collectContainers(ctx context.Context, k *kube, curNS string, all bool,
+	cfg columnCfg, fam rune, metric rune, rev bool) ([]containerRow, error) {
+
+	nsSel := curNS
+	if all {
+		nsSel = ""
+	}
+	pods, err := k.listPods(ctx, nsSel,
+		metav1.ListOptions{LabelSelector: cfg.labelSel, FieldSelector: cfg.fieldSel})
+	if err != nil {
+		return nil, err
+	}
+
+	usageMap := map[string]struct{ mem, cpu int64 }{}
+	if containsRune(cfg.metrics, 'u') && k.metrics != nil {
+		if list, err := k.listPodMetrics(ctx, nsSel, namespacesOf(pods)); err == nil {
+			for _, pm := range list.Items {
+				for _, c := range pm.Containers {
+					usageMap[key(pm.Namespace, key(pm.Name, c.Name))] = struct{ mem, cpu int64 }{
+						c.Usage.Memory().Value(), cfg.table.cpuUsage(c.Usage.Cpu())}
+				}
+			}
+		}
+	}
+
+	var rows []containerRow
+	for _, p := range pods.Items {
+		if all && cfg.excludeNS[p.Namespace] {
+			continue
+		}
+		for _, c := range specContainers(&p, cfg) {
+			r := containerRow{
+				ns:      p.Namespace,
+				pod:     p.Name,
+				name:    c.Name,
+				node:    p.Spec.NodeName,
+				created: p.CreationTimestamp.Time,
+				vals:    cfg.table.newFamMaps(cfg.metrics),
+			}
+			addContainerResources(r.vals, c.Resources, cfg.table)
+			if uDat, ok := usageMap[key(p.Namespace, key(p.Name, c.Name))]; ok {
+				r.vals['m']['u'] = uDat.mem
+				r.vals['c']['u'] = uDat.cpu
+			}
+			rows = append(rows, r)
+		}
+	}
+
+	if cfg.missing {
+		rows = slices.DeleteFunc(rows, func(r containerRow) bool { return !usageMissing(r.vals, cfg) })
+	}
+	if cfg.bounded {
+		rows = slices.DeleteFunc(rows, func(r containerRow) bool { return !inBounds(r.vals, fam, metric, cfg) })
+	}
+	k.debug.printf("containers: %d pods listed, usage for %d containers, %d rows after filters",
+		len(pods.Items), len(usageMap), len(rows))
+
+	less := func(a, b containerRow) bool {
+		if metric == ageKey {
+			return ageLess(a.created, b.created, rev)
+		}
+		if rev {
+			a, b = b, a
+		}
+		return containerLess(a, b, fam, metric, cfg.metrics)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return tieLess(less(rows[i], rows[j]), less(rows[j], rows[i]),
+			key(rows[i].ns, key(rows[i].pod, rows[i].name)), key(rows[j].ns, key(rows[j].pod, rows[j].name)))
+	})
+	for _, r := range rows {
+		k.checkFailOver(r.vals, cfg)
+		k.noteUsage(r.vals, cfg)
+	}
+
+	return rows, nil
+}
+
+func containerLess(a, b containerRow, fam, metric rune, metrics []rune) bool {
+	if metric == nameKey {
+		return a.name < b.name
+	}
+	return rowSortValue(a.vals, fam, metric, metrics) >
+		rowSortValue(b.vals, fam, metric, metrics)
+}
+
+func printContainers(w io.Writer, rows []containerRow, cfg columnCfg, all bool, fam rune, u unitCfg) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	hw := headerWriter(tw, cfg)
+
+	if all {
+		fmt.Fprint(hw, "NAMESPACE\t")
+	}
+	fmt.Fprint(hw, "POD\tCONTAINER\t")
+	if cfg.showNode {
+		fmt.Fprint(hw, "NODE\t")
+	}
+	writeHeaders(hw, cfg, fam)
+	fmt.Fprint(hw, "AGE\n")
+
+	tot := cfg.table.newFamMaps(cfg.metrics)
+
+	for _, r := range rows {
+		if all {
+			fmt.Fprintf(tw, "%s\t", r.ns)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t", truncate(r.pod, cfg.cellMax), truncate(r.name, cfg.cellMax))
+		if cfg.showNode {
+			fmt.Fprintf(tw, "%s\t", truncate(r.node, cfg.cellMax))
+		}
+		writeRowMetrics(tw, r.vals, cfg, fam, u)
+		fmt.Fprintf(tw, "%s\n", ageFmt(r.created, cfg.age))
+
+		accumulateTotals(tot, r.vals)
+	}
+
+	if cfg.total {
+		fmt.Fprint(tw, "TOTAL\t-\t")
+		if all {
+			fmt.Fprint(tw, "-\t")
+		}
+		if cfg.showNode {
+			fmt.Fprint(tw, "-\t")
+		}
+		writeRowMetrics(tw, tot, cfg, fam, u)
+		fmt.Fprint(tw, "-\n")
+	}
+
+	tw.Flush()
+}
+
+/* ---------- deployments ---------- */
+
+type deployRow struct {
+	ns, name string
+	ready    string // ready/desired replicas
+	desired  int32
+	nodes    int64 // distinct nodes the running pods sit on
+	created  time.Time
+	vals     famMaps
+}
+
+// oneNode reports a Deployment that wants more than one replica but has
+// every scheduled pod on the same node, so losing that node takes it down.
+func (r deployRow) oneNode() bool { return r.desired > 1 && r.nodes == 1 }
+
+// nodesCell is the NODES text, with a trailing ! for oneNode.
+func (r deployRow) nodesCell() string {
+	if r.oneNode() {
+		return fmt.Sprintf("%d!", r.nodes)
+	}
+	return fmt.Sprint(r.nodes)
+}
+
+// collectDeployments sums requests, limits and usage of the pods each
+// Deployment owns, following pod -> ReplicaSet -> Deployment owner
+// references, and counts the nodes those pods run on.
+func collectDeployments(ctx context.Context, k *kube, curNS string, all bool,
+	cfg columnCfg, fam rune, metric rune, rev bool) ([]deployRow, error) {
+
+	nsSel := curNS
+	if all {
+		nsSel = ""
+	}
+	deps, err := k.listDeployments(ctx, nsSel, metav1.ListOptions{LabelSelector: cfg.labelSel})
+	if err != nil {
+		return nil, err
+	}
+
+	idx := map[string]*deployRow{}
+	rows := make([]deployRow, 0, len(deps.Items))
+	for _, d := range deps.Items {
+		if all && cfg.excludeNS[d.Namespace] {
+			continue
+		}
+		desired := int32(1)
+		if d.Spec.Replicas != nil {
+			desired = *d.Spec.Replicas
+		}
+		rows = append(rows, deployRow{
+			ns:      d.Namespace,
+			name:    d.Name,
+			ready:   fmt.Sprintf("%d/%d", d.Status.ReadyReplicas, desired),
+			desired: desired,
+			created: d.CreationTimestamp.Time,
+			vals:    cfg.table.newFamMaps(cfg.metrics),
+		})
+		idx[key(d.Namespace, d.Name)] = &rows[len(rows)-1]
+	}
+
+	rsOwner := map[string]string{} // ns/replicaset -> ns/deployment
+	rss, err := k.listReplicaSets(ctx, nsSel)
+	if err != nil {
+		return nil, err
+	}
+	for _, rs := range rss.Items {
+		if ref := metav1.GetControllerOf(&rs); ref != nil && ref.Kind == "Deployment" {
+			rsOwner[key(rs.Namespace, rs.Name)] = key(rs.Namespace, ref.Name)
+		}
+	}
+
+	podOwner := map[string]*deployRow{}
+	onNodes := map[*deployRow]map[string]bool{}
+	pods, err := k.listPods(ctx, nsSel, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pods.Items {
+		ref := metav1.GetControllerOf(&p)
+		if ref == nil || ref.Kind != "ReplicaSet" {
+			continue
+		}
+		dr := idx[rsOwner[key(p.Namespace, ref.Name)]]
+		if dr == nil {
+			continue
+		}
+		podOwner[key(p.Namespace, p.Name)] = dr
+		addPodResources(dr.vals, &p, "rl", cfg)
+		if p.Spec.NodeName == "" || p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if onNodes[dr] == nil {
+			onNodes[dr] = map[string]bool{}
+		}
+		onNodes[dr][p.Spec.NodeName] = true
+	}
+	for dr, set := range onNodes {
+		dr.nodes = int64(len(set))
+	}
+
+	covered := 0
+	if containsRune(cfg.metrics, 'u') && k.metrics != nil {
+		if list, err := k.listPodMetrics(ctx, nsSel, namespacesOf(pods)); err == nil {
+			for _, pm := range list.Items {
+				dr := podOwner[key(pm.Namespace, pm.Name)]
+				if dr == nil {
+					continue
+				}
+				covered++
+				for _, c := range pm.Containers {
+					if systemContainer(c.Name, cfg) {
+						continue
+					}
+					dr.vals['m']['u'] = add64(dr.vals['m']['u'], c.Usage.Memory().Value())
+					dr.vals['c']['u'] = add64(dr.vals['c']['u'], cfg.table.cpuUsage(c.Usage.Cpu()))
+				}
+			}
+		}
+	}
+
+	if cfg.missing {
+		rows = slices.DeleteFunc(rows, func(r deployRow) bool { return !usageMissing(r.vals, cfg) })
+	}
+	if cfg.bounded {
+		rows = slices.DeleteFunc(rows, func(r deployRow) bool { return !inBounds(r.vals, fam, metric, cfg) })
+	}
+	k.debug.printf("deployments: %d listed, %d pods owned, usage for %d, %d rows after filters",
+		len(deps.Items), len(podOwner), covered, len(rows))
+
+	less := func(a, b deployRow) bool {
+		if metric == ageKey {
+			return ageLess(a.created, b.created, rev)
+		}
+		if rev {
+			a, b = b, a
+		}
+		return deployLess(a, b, fam, metric, cfg.metrics)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return tieLess(less(rows[i], rows[j]), less(rows[j], rows[i]),
+			key(rows[i].ns, rows[i].name), key(rows[j].ns, rows[j].name))
+	})
+	for _, r := range rows {
+		k.checkFailOver(r.vals, cfg)
+		k.noteUsage(r.vals, cfg)
+	}
+
+	return rows, nil
+}
+
+func deployLess(a, b deployRow, fam, metric rune, metrics []rune) bool {
+	if metric == nameKey {
+		return a.name < b.name
+	}
+	return rowSortValue(a.vals, fam, metric, metrics) >
+		rowSortValue(b.vals, fam, metric, metrics)
+}
+
+func printDeployments(w io.Writer, rows []deployRow, cfg columnCfg, all bool, fam rune, u unitCfg) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	hw := headerWriter(tw, cfg)
+
+	if all {
+		fmt.Fprint(hw, "NAMESPACE\t")
+	}
+	fmt.Fprint(hw, "NAME\tREADY\tNODES\t")
+	writeHeaders(hw, cfg, fam)
+	fmt.Fprint(hw, "AGE\n")
+
+	tot := cfg.table.newFamMaps(cfg.metrics)
+
+	for _, r := range rows {
+		if all {
+			fmt.Fprintf(tw, "%s\t", r.ns)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t", truncate(r.name, cfg.cellMax), r.ready, r.nodesCell())
+		writeRowMetrics(tw, r.vals, cfg, fam, u)
+		fmt.Fprintf(tw, "%s\n", ageFmt(r.created, cfg.age))
+
+		accumulateTotals(tot, r.vals)
+	}
+
+	if cfg.total {
+		if all {
+			fmt.Fprint(tw, "TOTAL\t-\t-\t-\t")
+		} else {
+			fmt.Fprint(tw, "TOTAL\t-\t-\t")
+		}
+		writeRowMetrics(tw, tot, cfg, fam, u)
+		fmt.Fprint(tw, "-\n")
+	}
+
+	tw.Flush()
+}
+
+/* ---------- persistentvolumeclaims ---------- */
+
+type pvcRow struct {
+	ns, name, status string
+	created          time.Time
+	vals             famMaps // storage in mem; cpu stays empty
+}
+
+// collectPVCs reads the requested and bound storage of each claim; a
+// claim that is not bound yet has no capacity.
+func collectPVCs(ctx context.Context, k *kube, curNS string, all bool,
+	cfg columnCfg, fam rune, metric rune, rev bool) ([]pvcRow, error) {
+
+	nsSel := curNS
+	if all {
+		nsSel = ""
+	}
+	pvcs, err := k.listPVCs(ctx, nsSel, metav1.ListOptions{LabelSelector: cfg.labelSel})
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]pvcRow, 0, len(pvcs.Items))
+	for _, c := range pvcs.Items {
+		if all && cfg.excludeNS[c.Namespace] {
+			continue
+		}
+		r := pvcRow{
+			ns:      c.Namespace,
+			name:    c.Name,
+			status:  string(c.Status.Phase),
+			created: c.CreationTimestamp.Time,
+			vals:    cfg.table.newFamMaps(cfg.metrics),
+		}
+		if q, ok := c.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+			r.vals['m']['r'] = q.Value()
+		}
+		if q, ok := c.Status.Capacity[corev1.ResourceStorage]; ok {
+			r.vals['m']['l'], r.vals['m']['t'] = q.Value(), q.Value()
+		}
+		rows = append(rows, r)
+	}
+
+	if cfg.bounded {
+		rows = slices.DeleteFunc(rows, func(r pvcRow) bool { return !inBounds(r.vals, fam, metric, cfg) })
+	}
+	k.debug.printf("pvc: %d listed, %d rows after filters", len(pvcs.Items), len(rows))
+
+	less := func(a, b pvcRow) bool {
+		if metric == ageKey {
+			return ageLess(a.created, b.created, rev)
+		}
+		if rev {
+			a, b = b, a
+		}
+		return pvcLess(a, b, fam, metric, cfg.metrics)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return tieLess(less(rows[i], rows[j]), less(rows[j], rows[i]),
+			key(rows[i].ns, rows[i].name), key(rows[j].ns, rows[j].name))
+	})
+	for _, r := range rows {
+		k.checkFailOver(r.vals, cfg)
+		k.noteUsage(r.vals, cfg)
+	}
+
+	return rows, nil
+}
+
+func pvcLess(a, b pvcRow, fam, metric rune, metrics []rune) bool {
+	switch metric {
+	case nameKey:
+		return a.name < b.name
+	case statusKey:
+		return a.status < b.status
+	}
+	return rowSortValue(a.vals, fam, metric, metrics) >
+		rowSortValue(b.vals, fam, metric, metrics)
+}
+
+func printPVCs(w io.Writer, rows []pvcRow, cfg columnCfg, all bool, fam rune, u unitCfg) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	hw := headerWriter(tw, cfg)
+
+	if all {
+		fmt.Fprint(hw, "NAMESPACE\t")
+	}
+	fmt.Fprint(hw, "NAME\tSTATUS\t")
+	writeHeaders(hw, cfg, fam)
+	fmt.Fprint(hw, "AGE\n")
+
+	tot := cfg.table.newFamMaps(cfg.metrics)
+
+	for _, r := range rows {
+		if all {
+			fmt.Fprintf(tw, "%s\t", r.ns)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t", truncate(r.name, cfg.cellMax), r.status)
+		writeRowMetrics(tw, r.vals, cfg, fam, u)
+		fmt.Fprintf(tw, "%s\n", ageFmt(r.created, cfg.age))
+
+		accumulateTotals(tot, r.vals)
+	}
+
+	if cfg.total {
+		if all {
+			fmt.Fprint(tw, "TOTAL\t-\t-\t")
+		} else {
+			fmt.Fprint(tw, "TOTAL\t-\t")
+		}
+		writeRowMetrics(tw, tot, cfg, fam, u)
+		fmt.Fprint(tw, "-\n")
+	}
+
+	tw.Flush()
+}
+
+/* ---------- API access ---------- */
+
+// kube bundles the API clients with the per-call deadline; every List
+// request goes through call so a slow endpoint can be told apart from
+// an exhausted overall --timeout.
+type kube struct {
+	core        kubernetes.Interface
+	metrics     metricsclient.Interface // nil when metrics are not needed
+	callTimeout time.Duration           // 0 = no per-call deadline
+	chunkSize   int64                   // list page size, 0 = unpaged
+	useCache    bool                    // serve lists from the watch cache
+	static      *staticObjects          // --from-file: no API server at all
+	debug       debugLog                // --debug
+	stats       runStats
+}
+
+func (k *kube) call(ctx context.Context, what string, fn func(context.Context) error) error {
+	cctx := ctx
+	if k.callTimeout > 0 {
+		var cancel context.CancelFunc
+		cctx, cancel = context.WithTimeout(ctx, k.callTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	err := fn(cctx)
+	k.debug.printf("%s: %s (err=%v)", what, time.Since(start).Round(time.Millisecond), err)
+	if err != nil && errors.Is(cctx.Err(), context.DeadlineExceeded) {
+		if ctx.Err() != nil {
+			log.Printf("%s: overall timeout exceeded", what)
+		} else {
+			log.Printf("%s: exceeded per-call timeout of %s", what, k.callTimeout)
+		}
+	}
+	return err
+}
+
+// paginate calls page with Limit/Continue set until the server reports
+// no more items, so a large list never arrives as a single response
+func (k *kube) paginate(opts metav1.ListOptions, page func(metav1.ListOptions) (string, error)) error {
+	opts = k.fromCache(opts)
+	opts.Limit = k.chunkSize
+	for {
+		next, err := page(opts)
+		if err != nil || next == "" {
+			return err
+		}
+		// the continue token pins the resourceVersion itself
+		opts.Continue, opts.ResourceVersion = next, ""
+	}
+}
+
+// fromCache sets resourceVersion=0 for --use-cache: any version the API
+// server has is fine, so it answers from its watch cache instead of etcd
+func (k *kube) fromCache(opts metav1.ListOptions) metav1.ListOptions {
+	if k.useCache {
+		opts.ResourceVersion = "0"
+	}
+	return opts
+}
+
+func (k *kube) listPods(ctx context.Context, ns string, opts metav1.ListOptions) (list *corev1.PodList, err error) {
+	if k.static != nil {
+		return k.static.podList(ns, opts), nil
+	}
+	err = k.call(ctx, "list pods", func(ctx context.Context) error {
+		list = &corev1.PodList{}
+		return k.paginate(opts, func(opts metav1.ListOptions) (string, error) {
+			l, err := k.core.CoreV1().Pods(ns).List(ctx, opts)
+			if err != nil {
+				return "", err
+			}
+			list.Items = append(list.Items, l.Items...)
+			return l.Continue, nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (k *kube) listNodes(ctx context.Context, opts metav1.ListOptions) (list *corev1.NodeList, err error) {
+	if k.static != nil {
+		return k.static.nodeList(opts), nil
+	}
+	err = k.call(ctx, "list nodes", func(ctx context.Context) error {
+		list = &corev1.NodeList{}
+		return k.paginate(opts, func(opts metav1.ListOptions) (string, error) {
+			l, err := k.core.CoreV1().Nodes().List(ctx, opts)
+			if err != nil {
+				return "", err
+			}
+			list.Items = append(list.Items, l.Items...)
+			return l.Continue, nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (k *kube) listNamespaces(ctx context.Context, opts metav1.ListOptions) (list *corev1.NamespaceList, err error) {
+	if k.static != nil {
+		return k.static.namespaceList(opts), nil
+	}
+	err = k.call(ctx, "list namespaces", func(ctx context.Context) error {
+		list = &corev1.NamespaceList{}
+		return k.paginate(opts, func(opts metav1.ListOptions) (string, error) {
+			l, err := k.core.CoreV1().Namespaces().List(ctx, opts)
+			if err != nil {
+				return "", err
+			}
+			list.Items = append(list.Items, l.Items...)
+			return l.Continue, nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (k *kube) listDeployments(ctx context.Context, ns string, opts metav1.ListOptions) (list *appsv1.DeploymentList, err error) {
+	if k.static != nil {
+		return k.static.deploymentList(ns, opts), nil
+	}
+	err = k.call(ctx, "list deployments", func(ctx context.Context) error {
+		list, err = k.core.AppsV1().Deployments(ns).List(ctx, k.fromCache(opts))
+		return err
+	})
+	return list, err
+}
+
+func (k *kube) listReplicaSets(ctx context.Context, ns string) (list *appsv1.ReplicaSetList, err error) {
+	if k.static != nil {
+		return k.static.replicaSetList(ns), nil
+	}
+	err = k.call(ctx, "list replicasets", func(ctx context.Context) error {
+		list, err = k.core.AppsV1().ReplicaSets(ns).List(ctx, k.fromCache(metav1.ListOptions{}))
+		return err
+	})
+	return list, err
+}
+
+func (k *kube) listPVCs(ctx context.Context, ns string, opts metav1.ListOptions) (list *corev1.PersistentVolumeClaimList, err error) {
+	if k.static != nil {
+		return k.static.pvcList(ns, opts), nil
+	}
+	err = k.call(ctx, "list persistentvolumeclaims", func(ctx context.Context) error {
+		list, err = k.core.CoreV1().PersistentVolumeClaims(ns).List(ctx, k.fromCache(opts))
+		return err
+	})
+	return list, err
+}
+
+func (k *kube) listResourceQuotas(ctx context.Context, ns string) (list *corev1.ResourceQuotaList, err error) {
+	if k.static != nil {
+		return k.static.quotaList(ns), nil
+	}
+	err = k.call(ctx, "list resourcequotas", func(ctx context.Context) error {
+		list, err = k.core.CoreV1().ResourceQuotas(ns).List(ctx, k.fromCache(metav1.ListOptions{}))
+		return err
+	})
+	return list, err
+}
+
+func (k *kube) listEvents(ctx context.Context, ns, fieldSel string) (list *corev1.EventList, err error) {
+	if k.static != nil {
+		return k.static.eventList(ns, fieldSel), nil
+	}
+	err = k.call(ctx, "list events", func(ctx context.Context) error {
+		list, err = k.core.CoreV1().Events(ns).List(ctx, k.fromCache(metav1.ListOptions{FieldSelector: fieldSel}))
+		return err
+	})
+	return list, err
+}
+
+func (k *kube) listNodeMetrics(ctx context.Context) (list *metricsv1beta1.NodeMetricsList, err error) {
+	err = k.call(ctx, "list node metrics", func(ctx context.Context) error {
+		list, err = k.metrics.MetricsV1beta1().NodeMetricses().List(ctx, metav1.ListOptions{})
+		return err
+	})
+	return list, err
+}
+
+// listPodMetrics lists pod metrics in ns ("" = all). Locked-down managed
+// clusters may forbid the cluster-wide list while allowing it per
+// namespace, so a Forbidden cluster-wide list falls back to one list per
+// namespace in fallback, skipping namespaces that are forbidden too.
+func (k *kube) listPodMetrics(ctx context.Context, ns string, fallback []string) (*metricsv1beta1.PodMetricsList, error) {
+	list, err := k.listPodMetricsIn(ctx, ns)
+	if ns != "" || !apierrors.IsForbidden(err) || len(fallback) == 0 {
+		return list, err
+	}
+	return k.listPodMetricsEach(ctx, fallback)
+}
+
+// podMetricsAsync starts listing pod metrics in ns and returns a function
+// that waits for it; the per-namespace fallback needs the pod list, so it
+// only runs once the caller has one
+func (k *kube) podMetricsAsync(ctx context.Context, ns string) func(*corev1.PodList) (*metricsv1beta1.PodMetricsList, error) {
+	var (
+		wg   sync.WaitGroup
+		list *metricsv1beta1.PodMetricsList
+		err  error
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		list, err = k.listPodMetricsIn(ctx, ns)
+	}()
+	return func(pods *corev1.PodList) (*metricsv1beta1.PodMetricsList, error) {
+		wg.Wait()
+		fallback := namespacesOf(pods)
+		if ns != "" || !apierrors.IsForbidden(err) || len(fallback) == 0 {
+			return list, err
+		}
+		return k.listPodMetricsEach(ctx, fallback)
+	}
+}
+
+// listPodMetricsEach lists pod metrics namespace by namespace, skipping
+// the ones that are forbidden too
+func (k *kube) listPodMetricsEach(ctx context.Context, namespaces []string) (*metricsv1beta1.PodMetricsList, error) {
+	merged := &metricsv1beta1.PodMetricsList{}
+	for _, n := range namespaces {
+		l, err := k.listPodMetricsIn(ctx, n)
+		if apierrors.IsForbidden(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		merged.Items = append(merged.Items, l.Items...)
+	}
+	return merged, nil
+}
+
+func (k *kube) listPodMetricsIn(ctx context.Context, ns string) (list *metricsv1beta1.PodMetricsList, err error) {
+	err = k.call(ctx, "list pod metrics", func(ctx context.Context) error {
+		list, err = k.metrics.MetricsV1beta1().PodMetricses(ns).List(ctx, metav1.ListOptions{})
+		return err
+	})
+	return list, err
+}
+
+// namespacesOf returns the distinct namespaces of the listed pods.
+func namespacesOf(pods *corev1.PodList) []string {
+	if pods == nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	var out []string
+	for _, p := range pods.Items {
+		if !seen[p.Namespace] {
+			seen[p.Namespace] = true
+			out = append(out, p.Namespace)
+		}
+	}
+	return out
+}
+
+/* ---------- misc helpers ---------- */
+
+func key(ns, name string) string { return ns + "/" + name }
+
+// debugLog is set by --debug; printf writes to stderr only, so piped
+// output stays clean.
+type debugLog bool
+
+func (d debugLog) printf(format string, args ...any) {
+	if d {
+		log.Printf("debug: "+format, args...)
+	}
+}
+
+// mustGet is must for calls that return a value as well.
+func mustGet[T any](v T, err error) T {
+	must(err)
+	return v
+}
+
+func must(err error) {
+	if errors.Is(err, context.Canceled) {
+		os.Exit(130) // interrupted: the signal says it all
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func mustClient(cfg *rest.Config) *kubernetes.Clientset {
+	c, err := kubernetes.NewForConfig(cfg)
+	must(err)
+	return c
+}
+
+// mustBuildConfig loads the kubeconfig the way kubectl does: path, when
+// set, replaces $KUBECONFIG and ~/.kube/config, and a non-empty
+// kubeContext replaces the current context, namespace included.
+func mustBuildConfig(path, kubeContext string) (*rest.Config, string) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = path
+	cfgLoader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules,
+		&clientcmd.ConfigOverrides{CurrentContext: kubeContext})
+	if kubeContext != "" {
+		raw, err := cfgLoader.RawConfig()
+		must(err)
+		if _, ok := raw.Contexts[kubeContext]; !ok {
+			log.Fatalf("context %q not found in kubeconfig", kubeContext)
+		}
+	}
+	ns, _, err := cfgLoader.Namespace()
+	must(err)
+	restCfg, err := cfgLoader.ClientConfig()
+	must(err)
+	if ns == "" {
+		ns = "default"
+	}
+	return restCfg, ns
+}
@@ -0,0 +1,900 @@
+package ps
+
+import (
+	"bytes"
+	"context"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	mfake "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+)
+
+func int32p(n int32) *int32 { return &n }
+
+func TestDeploymentNodes(t *testing.T) {
+	yes := true
+	owned := func(kind, name string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &yes}}
+	}
+	pod := func(name, rs, node string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, OwnerReferences: owned("ReplicaSet", rs)},
+			Spec:       corev1.PodSpec{NodeName: node},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+	}
+	client := fake.NewSimpleClientset(
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+			Spec: appsv1.DeploymentSpec{Replicas: int32p(3)}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "api"},
+			Spec: appsv1.DeploymentSpec{Replicas: int32p(2)}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "job"},
+			Spec: appsv1.DeploymentSpec{Replicas: int32p(1)}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-1", OwnerReferences: owned("Deployment", "web")}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "api-1", OwnerReferences: owned("Deployment", "api")}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "job-1", OwnerReferences: owned("Deployment", "job")}},
+		pod("web-a", "web-1", "n1"), pod("web-b", "web-1", "n1"), pod("web-c", "web-1", "n1"),
+		pod("api-a", "api-1", "n1"), pod("api-b", "api-1", "n2"), pod("api-c", "api-1", ""),
+		pod("job-a", "job-1", "n2"),
+	)
+
+	rows, err := CollectDeployments(context.Background(), client, nil, Options{Flags: "mr"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]struct {
+		nodes   int64
+		oneNode bool
+	}{"web": {1, true}, "api": {2, false}, "job": {1, false}}
+	for _, r := range rows {
+		w := want[r.Name]
+		if r.Nodes == nil || *r.Nodes != w.nodes || r.OneNode != w.oneNode {
+			t.Errorf("%s: nodes %v oneNode %v, want %d %v", r.Name, r.Nodes, r.OneNode, w.nodes, w.oneNode)
+		}
+	}
+
+	k, cfg, fam, metric, err := Options{Flags: "mr"}.setup(client, nil, "deployments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	drows, err := collectDeployments(context.Background(), k, "default", false, cfg, fam, metric, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	printDeployments(&buf, drows, cfg, false, fam, unitCfg{})
+	if !strings.Contains(buf.String(), "NODES") || !strings.Contains(buf.String(), " 1! ") {
+		t.Errorf("table lacks NODES or the one-node mark:\n%s", buf.String())
+	}
+}
+
+func TestStaticKinds(t *testing.T) {
+	dump := `apiVersion: v1
+kind: List
+items:
+- {apiVersion: apps/v1, kind: Deployment, metadata: {namespace: shop, name: web}, spec: {replicas: 1}}
+- apiVersion: apps/v1
+  kind: ReplicaSet
+  metadata: {namespace: shop, name: web-1, ownerReferences: [{apiVersion: apps/v1, kind: Deployment, name: web, uid: u1, controller: true}]}
+- apiVersion: v1
+  kind: Pod
+  metadata: {namespace: shop, name: web-a, ownerReferences: [{apiVersion: apps/v1, kind: ReplicaSet, name: web-1, uid: u2, controller: true}]}
+  spec: {nodeName: n1, containers: [{name: c, resources: {requests: {memory: 1Gi}}}]}
+  status: {phase: Running}
+- {apiVersion: v1, kind: PersistentVolumeClaim, metadata: {namespace: shop, name: data}}
+- {apiVersion: v1, kind: ResourceQuota, metadata: {namespace: shop, name: q}}
+- {apiVersion: v1, kind: Event, metadata: {namespace: shop, name: e1}, type: Warning, involvedObject: {kind: Pod, name: web-a}}
+- {apiVersion: v1, kind: Event, metadata: {namespace: shop, name: e2}, type: Normal, involvedObject: {kind: Pod, name: web-a}}
+`
+	path := filepath.Join(t.TempDir(), "dump.yaml")
+	if err := os.WriteFile(path, []byte(dump), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	static, err := loadStatic(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(static.pvcList("shop", metav1.ListOptions{}).Items); n != 1 {
+		t.Errorf("pvcs in shop: %d, want 1", n)
+	}
+	if n := len(static.quotaList("default").Items); n != 0 {
+		t.Errorf("quotas in default: %d, want 0", n)
+	}
+	if n := len(static.eventList("", "type=Warning,involvedObject.kind=Pod").Items); n != 1 {
+		t.Errorf("warning events: %d, want 1", n)
+	}
+
+	k := &kube{static: static}
+	cfg, _ := parseFlags("mr", "deployments")
+	rows, err := collectDeployments(context.Background(), k, "shop", false, cfg, 'm', 'r', false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].vals['m']['r'] != 1<<30 {
+		t.Errorf("deployments from the dump: %+v, want web with 1Gi requested", rows)
+	}
+}
+
+func TestCostValue(t *testing.T) {
+	vals := func(mem, cpu int64) famMaps {
+		fm := famTable.newFamMaps([]rune("r"))
+		fm['m']['r'], fm['c']['r'] = mem, cpu
+		return fm
+	}
+	cost := map[string]float64{"cpu": 20, "memory": 3}
+	for _, tc := range []struct {
+		name string
+		vals famMaps
+		cost map[string]float64
+		want float64
+	}{
+		{"cores and GiB", vals(4<<30, 2000), cost, 52},
+		{"cpu only known", vals(-1, 500), cost, 10},
+		{"nothing known", vals(-1, -1), cost, -1},
+		{"unpriced family", vals(4<<30, 2000), map[string]float64{"cpu": 1}, 2},
+	} {
+		cfg := columnCfg{table: famTable, cost: tc.cost}
+		if got := costValue(tc.vals, cfg); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPrices(t *testing.T) {
+	gpu, _ := famTable.withResource("nvidia.com/gpu")
+	for _, tc := range []struct {
+		cost map[string]float64
+		want map[string]float64
+		err  string
+	}{
+		{map[string]float64{"mem": 3, "eph": 1}, map[string]float64{"memory": 3, "ephemeral-storage": 1}, ""},
+		{map[string]float64{"cpu": 20, "nvidia.com/gpu": 400}, map[string]float64{"cpu": 20, "nvidia.com/gpu": 400}, ""},
+		{map[string]float64{"mem": 3, "memory": 4}, nil, "memory priced twice"},
+		{map[string]float64{"gpu": 400}, nil, "unknown resource gpu"},
+	} {
+		got, err := gpu.prices(tc.cost)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%v: error %v, want %q", tc.cost, err, tc.err)
+			}
+			continue
+		}
+		if err != nil || !maps.Equal(got, tc.want) {
+			t.Errorf("%v: got %v, %v, want %v", tc.cost, got, err, tc.want)
+		}
+	}
+	// an alias prices the family as costValue looks it up
+	prices, _ := famTable.prices(map[string]float64{"mem": 3})
+	vals := famTable.newFamMaps([]rune{'r'})
+	vals['m']['r'] = 2 << 30
+	if got := costValue(vals, columnCfg{table: famTable, cost: prices}); got != 6 {
+		t.Errorf("mem alias: cost %v, want 6", got)
+	}
+}
+
+func TestFamSetCopies(t *testing.T) {
+	gpu, letter := famTable.withResource("nvidia.com/gpu")
+	nano := gpu.withNanocores()
+	if len(famTable) != 3 || famTable.has(letter) {
+		t.Errorf("withResource changed famTable: %d families", len(famTable))
+	}
+	if !nano.has(letter) || nano.of(letter).prefix != "GPU_" {
+		t.Errorf("withNanocores lost the %c family", letter)
+	}
+	for _, tc := range []struct {
+		name string
+		set  famSet
+		want resource.Scale
+	}{{"famTable", famTable, resource.Milli}, {"gpu", gpu, resource.Milli}, {"nano", nano, resource.Nano}} {
+		if got := tc.set.of('c').scale; got != tc.want {
+			t.Errorf("%s: cpu scale %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	for _, tc := range []struct {
+		args         string
+		scope, flags string
+		opts         []string
+		err          bool
+	}{
+		{"pods mcu", "pods", "mcu", nil, false},
+		{"pods -A mcu", "pods", "mcu", []string{"-A"}, false},
+		{"-A pods mcu -t", "pods", "mcu", []string{"-A", "-t"}, false},
+		{"pods mcu -n foo mru", "pods", "mcur", []string{"-n", "foo"}, false},
+		{"pods mcu -n=foo ru", "pods", "mcur", []string{"-n", "foo"}, false},
+		{"nodes mrup lp", "nodes", "mruplp", nil, false},
+		{"pods mcu -A=x", "", "", nil, true},
+		{"pods mcu -n", "", "", nil, true},
+		{"pods mcu zz", "", "", nil, true},
+	} {
+		scope, flags, opts, err := splitArgs(strings.Fields(tc.args))
+		if (err != nil) != tc.err {
+			t.Errorf("%q: err %v, want error %v", tc.args, err, tc.err)
+			continue
+		}
+		if scope != tc.scope || flags != tc.flags || !slices.Equal(opts, tc.opts) {
+			t.Errorf("%q: got %q %q %q, want %q %q %q", tc.args, scope, flags, opts, tc.scope, tc.flags, tc.opts)
+		}
+	}
+}
+
+func TestMergeFlags(t *testing.T) {
+	for _, tc := range []struct{ flags, more, want string }{
+		{"mcu", "mru", "mcur"},
+		{"mcu", "cum", "mcu"},
+		{"mrup", "lp", "mruplp"},
+		{"mc", "", "mc"},
+	} {
+		if got := mergeFlags(tc.flags, tc.more); got != tc.want {
+			t.Errorf("mergeFlags(%q, %q) = %q, want %q", tc.flags, tc.more, got, tc.want)
+		}
+	}
+}
+
+func TestParseThreshold(t *testing.T) {
+	nano := famTable.withNanocores()
+	for _, tc := range []struct {
+		val  string
+		fam  family
+		want float64
+	}{
+		{"512Mi", famTable.of('m'), 512 << 20},
+		{"2Gi", famTable.of('m'), 2 << 30},
+		{"1G", famTable.of('m'), 1e9},
+		{"1.5Gi", famTable.of('m'), 1536 << 20},
+		{"250m", famTable.of('c'), 250},
+		{"1.5", famTable.of('c'), 1500},
+		{"2", famTable.of('c'), 2000},
+		{"250m", nano.of('c'), 250e6},
+		{"10Gi", famTable.of('e'), 10 << 30},
+	} {
+		if got := parseThreshold("--min", tc.val, tc.fam); got != tc.want {
+			t.Errorf("%s as %s: got %v, want %v", tc.val, tc.fam.names[0], got, tc.want)
+		}
+	}
+}
+
+func TestInBounds(t *testing.T) {
+	cfg, err := parseFlags("mcr", "pods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.bounded = true
+	cfg.minV = parseThreshold("--min", "512Mi", cfg.table.of('m'))
+	cfg.maxV = parseThreshold("--max", "1.5Gi", cfg.table.of('m'))
+	for _, tc := range []struct {
+		mem  int64
+		want bool
+	}{{256 << 20, false}, {512 << 20, true}, {1 << 30, true}, {2 << 30, false}, {-1, false}} {
+		vals := cfg.table.newFamMaps(cfg.metrics)
+		vals['m']['r'] = tc.mem
+		if got := inBounds(vals, 'm', 'r', cfg); got != tc.want {
+			t.Errorf("%d bytes within 512Mi..1.5Gi: got %v, want %v", tc.mem, got, tc.want)
+		}
+	}
+}
+
+// container is a container with the given cpu and memory requests and
+// limits; "" leaves a value unset.
+func container(reqCPU, reqMem, limCPU, limMem string) corev1.Container {
+	list := func(cpu, mem string) corev1.ResourceList {
+		rl := corev1.ResourceList{}
+		if cpu != "" {
+			rl[corev1.ResourceCPU] = resource.MustParse(cpu)
+		}
+		if mem != "" {
+			rl[corev1.ResourceMemory] = resource.MustParse(mem)
+		}
+		return rl
+	}
+	return corev1.Container{Resources: corev1.ResourceRequirements{
+		Requests: list(reqCPU, reqMem), Limits: list(limCPU, limMem)}}
+}
+
+func TestPodResourcesInitContainers(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		apps, inits []corev1.Container
+		allConts    bool
+		cpuR, memR  int64
+		cpuL, memL  int64
+	}{
+		{"apps only", []corev1.Container{container("100m", "64Mi", "200m", ""), container("100m", "64Mi", "", "")},
+			nil, false, 200, 128 << 20, 200, -1},
+		{"init below the apps sum", []corev1.Container{container("300m", "256Mi", "", "")},
+			[]corev1.Container{container("200m", "128Mi", "", "")}, false, 300, 256 << 20, -1, -1},
+		{"init above the apps sum", []corev1.Container{container("100m", "64Mi", "", "")},
+			[]corev1.Container{container("1", "1Gi", "2", "2Gi")}, false, 1000, 1 << 30, 2000, 2 << 30},
+		{"largest of several inits", []corev1.Container{container("100m", "", "", "")},
+			[]corev1.Container{container("400m", "", "", ""), container("700m", "", "", "")}, false, 700, -1, -1, -1},
+		{"--all-containers sums inits", []corev1.Container{container("100m", "64Mi", "", "")},
+			[]corev1.Container{container("1", "1Gi", "", "")}, true, 1100, 1088 << 20, -1, -1},
+	} {
+		cfg, err := parseFlags("mcrl", "pods")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.allConts = tc.allConts
+		p := &corev1.Pod{Spec: corev1.PodSpec{Containers: tc.apps, InitContainers: tc.inits}}
+		pr := podResources(p, cfg)
+		got := [4]int64{pr['c']['r'], pr['m']['r'], pr['c']['l'], pr['m']['l']}
+		if want := [4]int64{tc.cpuR, tc.memR, tc.cpuL, tc.memL}; got != want {
+			t.Errorf("%s: cpu/mem requests, limits %v, want %v", tc.name, got, want)
+		}
+	}
+}
+
+func TestPodResourcesOverhead(t *testing.T) {
+	overhead := corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("250m"),
+		corev1.ResourceMemory: resource.MustParse("160Mi"),
+	}
+	for _, tc := range []struct {
+		name       string
+		apps       []corev1.Container
+		overhead   corev1.ResourceList
+		cpuR, memR int64
+		cpuL, memL int64
+	}{
+		{"no overhead", []corev1.Container{container("500m", "1Gi", "1", "1Gi")}, nil, 500, 1 << 30, 1000, 1 << 30},
+		{"added to requests and limits", []corev1.Container{container("500m", "1Gi", "1", "1Gi")}, overhead,
+			750, 1<<30 + 160<<20, 1250, 1<<30 + 160<<20},
+		{"no limit stays unlimited", []corev1.Container{container("500m", "1Gi", "", "")}, overhead,
+			750, 1<<30 + 160<<20, -1, -1},
+		{"overhead alone", []corev1.Container{container("", "", "", "")}, overhead, 250, 160 << 20, -1, -1},
+	} {
+		cfg, err := parseFlags("mcrl", "pods")
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := &corev1.Pod{Spec: corev1.PodSpec{Containers: tc.apps, Overhead: tc.overhead}}
+		pr := podResources(p, cfg)
+		got := [4]int64{pr['c']['r'], pr['m']['r'], pr['c']['l'], pr['m']['l']}
+		if want := [4]int64{tc.cpuR, tc.memR, tc.cpuL, tc.memL}; got != want {
+			t.Errorf("%s: cpu/mem requests, limits %v, want %v", tc.name, got, want)
+		}
+	}
+}
+
+func TestWithoutUsage(t *testing.T) {
+	for _, tc := range []struct {
+		scope, flags string
+		metrics      string
+		fam, metric  rune
+	}{
+		{"nodes", "mfrl", "rl", 'm', 'r'},
+		{"nodes", "cmufl", "l", 'c', 'l'},
+		{"nodes", "mlrp", "lr", 'm', 'l'},
+		{"pods", "mcurdp", "r", 'm', 'r'},
+		{"pods", "cmru", "r", 'c', 'r'},
+	} {
+		cfg, err := parseFlags(tc.flags, tc.scope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fam, metric := detectSort(tc.flags)
+		cfg, fam, metric = withoutUsage(cfg, tc.flags, fam, metric)
+		if string(cfg.metrics) != tc.metrics || fam != tc.fam || metric != tc.metric {
+			t.Errorf("%s %s: metrics %q sort %c%c, want %q %c%c", tc.scope, tc.flags,
+				string(cfg.metrics), fam, metric, tc.metrics, tc.fam, tc.metric)
+		}
+	}
+}
+
+func TestParseSortBy(t *testing.T) {
+	cfg, err := parseFlags("mcur", "pods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		val         string
+		fam, metric rune
+	}{
+		{"name", 'm', nameKey},
+		{"age", 'm', ageKey},
+		{"status", 'm', statusKey},
+		{"mem.req", 'm', 'r'},
+		{"memory.r", 'm', 'r'},
+		{"cpu.use", 'c', 'u'},
+		{"cpu.usage", 'c', 'u'},
+	} {
+		if fam, metric := parseSortBy(tc.val, "pods", cfg, 'm'); fam != tc.fam || metric != tc.metric {
+			t.Errorf("--sort-by %s: got %c%c, want %c%c", tc.val, fam, metric, tc.fam, tc.metric)
+		}
+	}
+}
+
+func TestSortPodsDirection(t *testing.T) {
+	cfg, err := parseFlags("mr", "pods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	row := func(name string, mem int64, age time.Duration) podRow {
+		vals := cfg.table.newFamMaps(cfg.metrics)
+		vals['m']['r'] = mem
+		return podRow{ns: "default", name: name, created: base.Add(-age), vals: vals}
+	}
+	rows := []podRow{row("b", 2<<30, time.Hour), row("a", 1<<30, 3*time.Hour), row("c", 2<<30, 2*time.Hour)}
+	for _, tc := range []struct {
+		sortBy string
+		rev    bool
+		want   string
+	}{
+		{"name", false, "a b c"},
+		{"name", true, "c b a"},
+		{"age", false, "b c a"}, // newest first; --sort-by age reaches here as -r
+		{"age", true, "a c b"},
+		{"mem.req", false, "b c a"}, // largest first, ties by name
+		{"mem.req", true, "a b c"},
+	} {
+		fam, metric := parseSortBy(tc.sortBy, "pods", cfg, 'm')
+		got := slices.Clone(rows)
+		sortPods(got, cfg, fam, metric, tc.rev)
+		var names []string
+		for _, r := range got {
+			names = append(names, r.name)
+		}
+		if s := strings.Join(names, " "); s != tc.want {
+			t.Errorf("--sort-by %s, -r %v: got %s, want %s", tc.sortBy, tc.rev, s, tc.want)
+		}
+	}
+}
+
+func TestTiesSortByName(t *testing.T) {
+	node := func(name string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.NodeStatus{Allocatable: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("8Gi")}}}
+	}
+	pod := func(ns, name string) *corev1.Pod {
+		c := container("", "1Gi", "", "")
+		c.Name = "c"
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{c}}}
+	}
+	client := fake.NewSimpleClientset(node("z"), node("a"), node("m"),
+		pod("web", "b"), pod("api", "b"), pod("web", "a"))
+
+	for _, tc := range []struct {
+		name    string
+		collect func(Options) ([]Row, error)
+		opts    Options
+		want    string
+	}{
+		{"nodes", func(o Options) ([]Row, error) { return CollectNodes(context.Background(), client, nil, o) },
+			Options{Flags: "ml"}, "a m z"},
+		{"nodes -r", func(o Options) ([]Row, error) { return CollectNodes(context.Background(), client, nil, o) },
+			Options{Flags: "ml", Reverse: true}, "a m z"},
+		{"pods -A", func(o Options) ([]Row, error) { return CollectPods(context.Background(), client, nil, o) },
+			Options{Flags: "mr", AllNamespaces: true}, "api/b web/a web/b"},
+	} {
+		rows, err := tc.collect(tc.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, r := range rows {
+			if r.Namespace != "" {
+				names = append(names, r.Namespace+"/"+r.Name)
+			} else {
+				names = append(names, r.Name)
+			}
+		}
+		if got := strings.Join(names, " "); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCollectWithMetrics(t *testing.T) {
+	pod := func(name, node string) *corev1.Pod {
+		c := container("100m", "128Mi", "", "")
+		c.Name = "app"
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec: corev1.PodSpec{NodeName: node, Containers: []corev1.Container{c}}}
+	}
+	usage := func(cpu, mem string) corev1.ResourceList {
+		return corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu), corev1.ResourceMemory: resource.MustParse(mem)}
+	}
+	client := fake.NewSimpleClientset(pod("a", "n1"), pod("b", "n1"),
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "n1"},
+			Status: corev1.NodeStatus{Allocatable: usage("4", "8Gi")}})
+
+	metrics := &mfake.Clientset{}
+	metrics.AddReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &metricsv1beta1.PodMetricsList{Items: []metricsv1beta1.PodMetrics{
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a"},
+				Containers: []metricsv1beta1.ContainerMetrics{{Name: "app", Usage: usage("50m", "100Mi")}}},
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "b"},
+				Containers: []metricsv1beta1.ContainerMetrics{{Name: "app", Usage: usage("150m", "300Mi")}}},
+		}}, nil
+	})
+	metrics.AddReactor("list", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &metricsv1beta1.NodeMetricsList{Items: []metricsv1beta1.NodeMetrics{
+			{ObjectMeta: metav1.ObjectMeta{Name: "n1"}, Usage: usage("1", "2Gi")},
+		}}, nil
+	})
+
+	ctx := context.Background()
+	pods, err := CollectPods(ctx, client, metrics, Options{Flags: "mcru"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes, err := CollectNodes(ctx, client, metrics, Options{Flags: "mcru"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	val := func(m map[string]*int64, k string) int64 {
+		if m[k] == nil {
+			return -1
+		}
+		return *m[k]
+	}
+	for _, tc := range []struct {
+		name             string
+		row              Row
+		memR, memU, cpuU int64
+	}{
+		{"pod a", pods[0], 128 << 20, 100 << 20, 50}, // equal requests: by name
+		{"pod b", pods[1], 128 << 20, 300 << 20, 150},
+		{"node n1", nodes[0], 256 << 20, 2 << 30, 1000},
+	} {
+		got := [3]int64{val(tc.row.Memory, "requests"), val(tc.row.Memory, "usage"), val(tc.row.CPU, "usage")}
+		if want := [3]int64{tc.memR, tc.memU, tc.cpuU}; got != want {
+			t.Errorf("%s (%s): mem requests, mem usage, cpu usage %v, want %v", tc.name, tc.row.Name, got, want)
+		}
+	}
+}
+
+func TestAgeFmt(t *testing.T) {
+	asOf := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		age  time.Duration
+		unit ageUnit
+		want string
+	}{
+		{59 * time.Second, ageAuto, "59s"},
+		{60 * time.Second, ageAuto, "1m"},
+		{59 * time.Minute, ageAuto, "59m"},
+		{47 * time.Hour, ageAuto, "47h"},
+		{48 * time.Hour, ageAuto, "2d"},
+		{59 * time.Second, agePrecise, "59s"},
+		{5*time.Minute + 12*time.Second, agePrecise, "5m12s"},
+		{3 * time.Hour, agePrecise, "3h"},
+		{47*time.Hour + 30*time.Minute, agePrecise, "47h30m"},
+		{51 * time.Hour, agePrecise, "2d3h"},
+		{90 * time.Second, ageSeconds, "90"},
+		{90 * time.Minute, ageHours, "1h"},
+		{-time.Minute, ageAuto, "-"}, // created after --as-of
+	} {
+		if got := ageFmt(asOf.Add(-tc.age), ageOpts{unit: tc.unit, asOf: asOf}); got != tc.want {
+			t.Errorf("age %v, unit %d: got %s, want %s", tc.age, tc.unit, got, tc.want)
+		}
+	}
+	if got := ageFmt(time.Time{}, ageOpts{}); got != "-" {
+		t.Errorf("zero time: got %s, want -", got)
+	}
+}
+
+func TestMemFmt(t *testing.T) {
+	human := unitCfg{mem: unitHuman, precision: -1}
+	for _, tc := range []struct {
+		b    int64
+		u    unitCfg
+		want string
+	}{
+		{512 << 20, human, "512.0M"},
+		{1536 << 20, human, "1.50G"},
+		{2 << 40, human, "2.00T"},
+		{1e9, unitCfg{mem: unitHuman, si: true, precision: -1}, "1.00GB"},
+		{2048, unitCfg{mem: unitKi, precision: -1}, "2"},
+		{1536 << 10, unitCfg{mem: unitMi, precision: -1}, "1.5"},
+		{1 << 30, unitCfg{mem: unitGi, precision: -1}, "1.00"},
+		{3 << 39, unitCfg{mem: unitTi, precision: -1}, "1.500"},
+		{1 << 30, unitCfg{mem: unitGi, precision: 0}, "1"},
+		{1234, unitCfg{mem: unitBytes, precision: -1}, "1234"},
+		{256 << 20, unitCfg{mem: unitQuantity, precision: -1}, "256Mi"},
+		{256<<20 + 1, unitCfg{mem: unitQuantity, precision: -1}, "257Mi"},
+	} {
+		if got := memFmt(tc.b, tc.u); got != tc.want {
+			t.Errorf("memFmt(%d, %+v) = %s, want %s", tc.b, tc.u, got, tc.want)
+		}
+	}
+}
+
+func TestCollapsePods(t *testing.T) {
+	cfg, err := parseFlags("mr", "pods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := func(name, kind, ctrl, node, status, ready string, mem int64, restarts int64) podRow {
+		vals := cfg.table.newFamMaps(cfg.metrics)
+		vals['m']['r'] = mem
+		return podRow{ns: "shop", name: name, ctrlKind: kind, ctrlName: ctrl, node: node,
+			status: status, ready: ready, restarts: restarts, vals: vals}
+	}
+	rows := collapsePods([]podRow{
+		row("web-5d8f-a", "ReplicaSet", "web", "n1", "Running", "1/1", 256<<20, 1),
+		row("debug", "", "", "n1", "Running", "1/1", 64<<20, 0),
+		row("web-5d8f-b", "ReplicaSet", "web", "n2", "Running", "1/1", 256<<20, 0),
+		row("db-0", "StatefulSet", "db", "n2", "Running", "2/2", 1<<30, 0),
+		row("web-77c1-c", "ReplicaSet", "web", "n1", "Pending", "0/1", 256<<20, 2),
+		row("db-1", "StatefulSet", "db", "n2", "Running", "1/2", 1<<30, 0),
+	})
+	type want struct {
+		name, ready, status, node string
+		mem, restarts             int64
+	}
+	wants := []want{
+		{"debug", "1/1", "Running", "n1", 64 << 20, 0},
+		{"web", "2/3", "2 Running, 1 Pending", "-", 768 << 20, 3},
+		{"db", "1/2", "2 Running", "n2", 2 << 30, 0},
+	}
+	if len(rows) != len(wants) {
+		t.Fatalf("got %d rows, want %d", len(rows), len(wants))
+	}
+	for i, w := range wants {
+		r := rows[i]
+		got := want{r.name, r.ready, r.status, r.node, r.vals['m']['r'], r.restarts}
+		if got != w {
+			t.Errorf("row %d: got %+v, want %+v", i, got, w)
+		}
+	}
+}
+
+func TestNodeStatusColor(t *testing.T) {
+	cfg, _ := parseFlags("mr", "pods")
+	cfg.nodeStat, cfg.color, cfg.warnPct, cfg.critPct, cfg.cellMax = true, true, 80, 90, 48
+	var rows []podRow
+	for _, s := range []string{"Ready", "Ready,SchedulingDisabled", "NotReady", "NotReady,SchedulingDisabled", "Missing", "-"} {
+		vals := cfg.table.newFamMaps(cfg.metrics)
+		rows = append(rows, podRow{ns: "default", name: s, ready: "1/1", status: "Running", nodeStatus: s, vals: vals})
+	}
+	var buf bytes.Buffer
+	printPods(&buf, rows, cfg, false, 'm', unitCfg{})
+	lines := strings.Split(buf.String(), "\n")
+	if !strings.Contains(lines[0], ansiDefault+"NODE-STATUS"+ansiReset) {
+		t.Errorf("header lacks a plain code pair: %q", lines[0])
+	}
+	for _, l := range lines[1 : len(rows)+1] {
+		name := strings.Fields(l)[0]
+		red := strings.Contains(l, ansiRed+name+ansiReset)
+		if want := strings.HasPrefix(name, "NotReady") || name == "Missing"; red != want {
+			t.Errorf("%s: red %v, want %v: %q", name, red, want, l)
+		}
+	}
+}
+
+func TestNodeCSVTotalAlloc(t *testing.T) {
+	cfg, _ := parseFlags("mrP", "nodes")
+	cfg.total = true
+	var rows []nodeRow
+	for _, n := range []struct {
+		name       string
+		req, alloc int64
+	}{{"a", 1 << 30, 4 << 30}, {"b", 3 << 30, 4 << 30}} {
+		vals := cfg.table.newFamMaps(cfg.metrics)
+		vals['m']['r'], vals['m']['l'], vals['m'][allocKey] = n.req, n.alloc, n.alloc
+		rows = append(rows, nodeRow{name: n.name, status: "Ready", vals: vals})
+	}
+	lead, tail, lines := nodeCSV(rows)
+	var buf bytes.Buffer
+	if err := printCSV(&buf, lead, tail, lines, cfg, 'm', unitCfg{mem: unitBytes, precision: -1}); err != nil {
+		t.Fatal(err)
+	}
+	out := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if got := out[len(out)-1]; !strings.HasPrefix(got, "TOTAL,,4294967296,50%,") {
+		t.Errorf("TOTAL row %q, want MEM_REQ_ALLOC 50%% of the summed allocatable", got)
+	}
+}
+
+func TestMetricKeys(t *testing.T) {
+	nodes, _ := parseFlags("mlo", "nodes")
+	for _, tc := range []struct {
+		m    rune
+		want string
+	}{{'o', "podLimits"}, {'l', "allocatable"}, {'s', "reserved"}} {
+		if got := metricKey(tc.m, nodes); got != tc.want {
+			t.Errorf("%c: key %q, want %q", tc.m, got, tc.want)
+		}
+		if got := metricLetter(tc.want); got != tc.m {
+			t.Errorf("%s: letter %q, want %q", tc.want, got, tc.m)
+		}
+	}
+}
+
+func TestControllerOf(t *testing.T) {
+	yes := true
+	for _, tc := range []struct {
+		kind, owner, hash string
+		wantKind, want    string
+	}{
+		{"ReplicaSet", "web-5d8f9c", "5d8f9c", "ReplicaSet", "web"},
+		{"ReplicaSet", "web-5d8f9c", "", "ReplicaSet", "web-5d8f9c"},
+		{"StatefulSet", "db", "", "StatefulSet", "db"},
+		{"", "", "", "", ""},
+	} {
+		p := &corev1.Pod{}
+		if tc.kind != "" {
+			p.OwnerReferences = []metav1.OwnerReference{{Kind: tc.kind, Name: tc.owner, Controller: &yes}}
+		}
+		if tc.hash != "" {
+			p.Labels = map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: tc.hash}
+		}
+		if kind, name := controllerOf(p); kind != tc.wantKind || name != tc.want {
+			t.Errorf("%s %s: got %s %s, want %s %s", tc.kind, tc.owner, kind, name, tc.wantKind, tc.want)
+		}
+	}
+}
+
+func TestPercentHeaders(t *testing.T) {
+	for _, tc := range []struct{ scope, flags, want string }{
+		{"nodes", "mrulp", "MEM_REQ MEM_USE MEM_LIM MEM_USE_LIM"},
+		{"nodes", "mrlp", "MEM_REQ MEM_LIM MEM_REQ_LIM"},
+		{"nodes", "mrup", "MEM_REQ MEM_USE MEM_REQ_USE"},
+		{"nodes", "mpru", "MEM_REQ_USE MEM_REQ MEM_USE"},
+		{"nodes", "mruplp", "MEM_REQ MEM_USE MEM_REQ_USE MEM_LIM MEM_USE_LIM"},
+		{"pods", "murdp", "MEM_USE MEM_REQ MEM_DELTA MEM_USE_REQ"},
+		{"pods", "cmurp", "CPU_USE CPU_REQ CPU_USE_REQ MEM_USE MEM_REQ MEM_USE_REQ"},
+	} {
+		cfg, err := parseFlags(tc.flags, tc.scope)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.flags, err)
+		}
+		fam, _ := detectSort(tc.flags)
+		var b strings.Builder
+		writeHeaders(&b, cfg, fam)
+		if got := strings.Join(strings.Fields(b.String()), " "); got != tc.want {
+			t.Errorf("%s %s: headers %q, want %q", tc.scope, tc.flags, got, tc.want)
+		}
+	}
+}
+
+func TestPercentOperands(t *testing.T) {
+	mp := map[rune]int64{'r': 200, 'u': 100, 'l': 400}
+	for _, tc := range []struct {
+		flags string
+		want  []string // one cell per p, the earlier column over the later
+	}{
+		{"mrup", []string{"200%"}},
+		{"mrulp", []string{"25%"}},
+		{"murp", []string{"50%"}},
+		{"mpru", []string{"200%"}}, // no columns before: the row's first two
+		{"mruplp", []string{"200%", "25%"}},
+		{"mrplup", []string{"50%", "400%"}},
+	} {
+		cfg, err := parseFlags(tc.flags, "nodes")
+		if err != nil {
+			t.Fatalf("%s: %v", tc.flags, err)
+		}
+		var got []string
+		for i, m := range cfg.metrics {
+			if m == 'p' {
+				x, y := pctOperands(mp, cfg.metrics, i)
+				got = append(got, pct(x, y))
+			}
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.flags, got, tc.want)
+		}
+	}
+	// sorting on p uses the first one
+	cfg, _ := parseFlags("muplrp", "nodes")
+	if got := percentValue(mp, cfg.metrics); got != 0.25 {
+		t.Errorf("percentValue: got %v, want 0.25", got)
+	}
+}
+
+func TestColumnOrder(t *testing.T) {
+	for _, tc := range []struct{ flags, order, headers, cells string }{
+		{"mrup", "ur", "MEM_USE MEM_REQ MEM_REQ_USE", "100 200 200%"},
+		{"mrup", "pr", "MEM_REQ_USE MEM_REQ MEM_USE", "200% 200 100"},
+		{"mrulp", "l", "MEM_LIM MEM_REQ MEM_USE MEM_USE_LIM", "400 200 100 25%"},
+		// every p stays, each with the pair it divides in the flags
+		{"mruplp", "l", "MEM_LIM MEM_REQ MEM_USE MEM_REQ_USE MEM_USE_LIM", "400 200 100 200% 25%"},
+		{"mruplp", "pr", "MEM_REQ_USE MEM_USE_LIM MEM_REQ MEM_USE MEM_LIM", "200% 25% 200 100 400"},
+		{"mrPuP", "u", "MEM_USE MEM_REQ MEM_REQ_ALLOC MEM_USE_ALLOC", "100 200 50% 25%"},
+	} {
+		cfg, err := parseFlags(tc.flags, "nodes")
+		if err != nil {
+			t.Fatalf("%s: %v", tc.flags, err)
+		}
+		applyColumnOrder(&cfg, tc.order)
+		vals := cfg.table.newFamMaps(cfg.metrics)
+		vals['m']['r'], vals['m']['u'], vals['m']['l'] = 200, 100, 400
+		vals['m'][allocKey] = 400
+		var h, c strings.Builder
+		writeHeaders(&h, cfg, 'm')
+		writeRowMetrics(&c, vals, cfg, 'm', unitCfg{mem: unitBytes, precision: -1})
+		if got := strings.Join(strings.Fields(h.String()), " "); got != tc.headers {
+			t.Errorf("%s --column-order %s: headers %q, want %q", tc.flags, tc.order, got, tc.headers)
+		}
+		if got := strings.Join(strings.Fields(c.String()), " "); got != tc.cells {
+			t.Errorf("%s --column-order %s: cells %q, want %q", tc.flags, tc.order, got, tc.cells)
+		}
+	}
+
+	// the sort on p divides the flag operands, not the printed neighbours
+	cfg, _ := parseFlags("mrup", "pods")
+	applyColumnOrder(&cfg, "ur")
+	row := func(name string, req, use int64) podRow {
+		vals := cfg.table.newFamMaps(cfg.metrics)
+		vals['m']['r'], vals['m']['u'] = req, use
+		return podRow{ns: "default", name: name, vals: vals}
+	}
+	rows := []podRow{row("low", 100, 400), row("high", 200, 100)}
+	sortPods(rows, cfg, 'm', 'p', false)
+	if rows[0].name != "high" {
+		t.Errorf("sort on p with --column-order ur: %s first, want high (REQ/USE 200%%)", rows[0].name)
+	}
+}
+
+func TestParseFlagsRepeats(t *testing.T) {
+	for _, tc := range []struct {
+		flags, err string // "" for no error
+	}{
+		{"mruplp", ""},
+		{"mcrup", ""},
+		{"mrur", "flag r given twice"},
+		{"mcmr", ""}, // a repeated family is folded into the first
+
+		{"mrupup", "flag u given twice"},
+		{"mrupp", "a second p divides"},
+		{"mrupurp", "flag u given twice"},
+		{"mrPuP", ""},
+		{"mrPP", "a second P divides r"},
+	} {
+		_, err := parseFlags(tc.flags, "nodes")
+		switch {
+		case tc.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tc.flags, err)
+		case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+			t.Errorf("%s: error %v, want one containing %q", tc.flags, err, tc.err)
+		}
+	}
+}
+
+func TestCPUFmt(t *testing.T) {
+	for _, tc := range []struct {
+		v    int64
+		u    unitCfg
+		want string
+	}{
+		{2500, unitCfg{}, "2500"},
+		{2500, unitCfg{cpu: cpuCores}, "2.5"},
+		{250, unitCfg{cpu: cpuCores}, "0.25"},
+		{2500, unitCfg{mem: unitQuantity}, "2500m"},
+		{2000, unitCfg{mem: unitQuantity}, "2"},
+		{2500000000, unitCfg{cpu: cpuNano}, "2500000000"},
+		{1500, unitCfg{mem: unitQuantity, cpu: cpuNano}, "1500n"},
+	} {
+		if got := cpuFmt(tc.v, tc.u); got != tc.want {
+			t.Errorf("cpuFmt(%d, %+v) = %s, want %s", tc.v, tc.u, got, tc.want)
+		}
+	}
+}
+
+func TestNanocoreUsage(t *testing.T) {
+	q := resource.MustParse("1500n")
+	if got := famTable.cpuUsage(&q); got != 1 {
+		t.Errorf("milli: got %d, want 1 (rounded up)", got)
+	}
+	if got := famTable.withNanocores().cpuUsage(&q); got != 1500 {
+		t.Errorf("nano: got %d, want 1500", got)
+	}
+}
@@ -0,0 +1,220 @@
+package ps
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// staticObjects are the objects of a --from-file dump, served by the
+// kube list functions in place of the API server. Kinds no view reads
+// are skipped, and there is no usage.
+type staticObjects struct {
+	pods        []corev1.Pod
+	nodes       []corev1.Node
+	namespaces  []corev1.Namespace
+	deployments []appsv1.Deployment
+	replicaSets []appsv1.ReplicaSet
+	pvcs        []corev1.PersistentVolumeClaim
+	quotas      []corev1.ResourceQuota
+	events      []corev1.Event
+}
+
+// loadStatic reads the output of kubectl get -o yaml or -o json: a List
+// of any mix of kinds, a typed list such as a PodList, or one object.
+func loadStatic(path string, debug debugLog) (*staticObjects, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	js, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var top struct {
+		Kind  string            `json:"kind"`
+		Items []json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(js, &top); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	items, itemKind := top.Items, strings.TrimSuffix(top.Kind, "List")
+	if !strings.HasSuffix(top.Kind, "List") {
+		items = []json.RawMessage{js}
+	}
+
+	s := &staticObjects{}
+	for i, raw := range items {
+		var meta struct {
+			Kind string `json:"kind"`
+		}
+		if err := json.Unmarshal(raw, &meta); err != nil {
+			return nil, fmt.Errorf("%s: item %d: %w", path, i, err)
+		}
+		kind := meta.Kind
+		if kind == "" {
+			kind = itemKind // items of a typed list carry no kind
+		}
+		var obj any
+		switch kind {
+		case "Pod":
+			s.pods = append(s.pods, corev1.Pod{})
+			obj = &s.pods[len(s.pods)-1]
+		case "Node":
+			s.nodes = append(s.nodes, corev1.Node{})
+			obj = &s.nodes[len(s.nodes)-1]
+		case "Namespace":
+			s.namespaces = append(s.namespaces, corev1.Namespace{})
+			obj = &s.namespaces[len(s.namespaces)-1]
+		case "Deployment":
+			s.deployments = append(s.deployments, appsv1.Deployment{})
+			obj = &s.deployments[len(s.deployments)-1]
+		case "ReplicaSet":
+			s.replicaSets = append(s.replicaSets, appsv1.ReplicaSet{})
+			obj = &s.replicaSets[len(s.replicaSets)-1]
+		case "PersistentVolumeClaim":
+			s.pvcs = append(s.pvcs, corev1.PersistentVolumeClaim{})
+			obj = &s.pvcs[len(s.pvcs)-1]
+		case "ResourceQuota":
+			s.quotas = append(s.quotas, corev1.ResourceQuota{})
+			obj = &s.quotas[len(s.quotas)-1]
+		case "Event":
+			s.events = append(s.events, corev1.Event{})
+			obj = &s.events[len(s.events)-1]
+		default:
+			debug.printf("--from-file: skipping item %d of kind %q", i, kind)
+			continue
+		}
+		if err := json.Unmarshal(raw, obj); err != nil {
+			return nil, fmt.Errorf("%s: item %d (%s): %w", path, i, kind, err)
+		}
+	}
+	debug.printf("--from-file: %d pods, %d nodes, %d namespaces, %d deployments, %d replicasets, %d pvcs, %d quotas, %d events",
+		len(s.pods), len(s.nodes), len(s.namespaces), len(s.deployments), len(s.replicaSets), len(s.pvcs), len(s.quotas), len(s.events))
+	return s, nil
+}
+
+// listMatches applies what the API server would: the namespace, the
+// label selector and the field selector against the fields given.
+func listMatches(ns string, opts metav1.ListOptions, meta metav1.ObjectMeta, fs fields.Set) bool {
+	if ns != "" && meta.Namespace != ns {
+		return false
+	}
+	if sel, err := labels.Parse(opts.LabelSelector); err == nil && !sel.Matches(labels.Set(meta.Labels)) {
+		return false
+	}
+	if sel, err := fields.ParseSelector(opts.FieldSelector); err == nil && !sel.Matches(fs) {
+		return false
+	}
+	return true
+}
+
+func (s *staticObjects) podList(ns string, opts metav1.ListOptions) *corev1.PodList {
+	list := &corev1.PodList{}
+	for _, p := range s.pods {
+		fs := fields.Set{
+			"metadata.name":           p.Name,
+			"metadata.namespace":      p.Namespace,
+			"spec.nodeName":           p.Spec.NodeName,
+			"spec.schedulerName":      p.Spec.SchedulerName,
+			"spec.serviceAccountName": p.Spec.ServiceAccountName,
+			"status.phase":            string(p.Status.Phase),
+			"status.podIP":            p.Status.PodIP,
+		}
+		if listMatches(ns, opts, p.ObjectMeta, fs) {
+			list.Items = append(list.Items, p)
+		}
+	}
+	return list
+}
+
+func (s *staticObjects) nodeList(opts metav1.ListOptions) *corev1.NodeList {
+	list := &corev1.NodeList{}
+	for _, n := range s.nodes {
+		if listMatches("", opts, n.ObjectMeta, fields.Set{"metadata.name": n.Name}) {
+			list.Items = append(list.Items, n)
+		}
+	}
+	return list
+}
+
+func (s *staticObjects) namespaceList(opts metav1.ListOptions) *corev1.NamespaceList {
+	list := &corev1.NamespaceList{}
+	for _, n := range s.namespaces {
+		fs := fields.Set{"metadata.name": n.Name, "status.phase": string(n.Status.Phase)}
+		if listMatches("", opts, n.ObjectMeta, fs) {
+			list.Items = append(list.Items, n)
+		}
+	}
+	return list
+}
+
+func (s *staticObjects) deploymentList(ns string, opts metav1.ListOptions) *appsv1.DeploymentList {
+	list := &appsv1.DeploymentList{}
+	for _, d := range s.deployments {
+		fs := fields.Set{"metadata.name": d.Name, "metadata.namespace": d.Namespace}
+		if listMatches(ns, opts, d.ObjectMeta, fs) {
+			list.Items = append(list.Items, d)
+		}
+	}
+	return list
+}
+
+func (s *staticObjects) replicaSetList(ns string) *appsv1.ReplicaSetList {
+	list := &appsv1.ReplicaSetList{}
+	for _, rs := range s.replicaSets {
+		if listMatches(ns, metav1.ListOptions{}, rs.ObjectMeta, nil) {
+			list.Items = append(list.Items, rs)
+		}
+	}
+	return list
+}
+
+func (s *staticObjects) pvcList(ns string, opts metav1.ListOptions) *corev1.PersistentVolumeClaimList {
+	list := &corev1.PersistentVolumeClaimList{}
+	for _, c := range s.pvcs {
+		fs := fields.Set{"metadata.name": c.Name, "metadata.namespace": c.Namespace}
+		if listMatches(ns, opts, c.ObjectMeta, fs) {
+			list.Items = append(list.Items, c)
+		}
+	}
+	return list
+}
+
+func (s *staticObjects) quotaList(ns string) *corev1.ResourceQuotaList {
+	list := &corev1.ResourceQuotaList{}
+	for _, q := range s.quotas {
+		if listMatches(ns, metav1.ListOptions{}, q.ObjectMeta, nil) {
+			list.Items = append(list.Items, q)
+		}
+	}
+	return list
+}
+
+func (s *staticObjects) eventList(ns, fieldSel string) *corev1.EventList {
+	list := &corev1.EventList{}
+	opts := metav1.ListOptions{FieldSelector: fieldSel}
+	for _, e := range s.events {
+		fs := fields.Set{
+			"metadata.name":            e.Name,
+			"metadata.namespace":       e.Namespace,
+			"type":                     e.Type,
+			"reason":                   e.Reason,
+			"involvedObject.kind":      e.InvolvedObject.Kind,
+			"involvedObject.name":      e.InvolvedObject.Name,
+			"involvedObject.namespace": e.InvolvedObject.Namespace,
+		}
+		if listMatches(ns, opts, e.ObjectMeta, fs) {
+			list.Items = append(list.Items, e)
+		}
+	}
+	return list
+}
@@ -0,0 +1,75 @@
+package ps
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// podStatus renders the STATUS string the way kubectl get pods does
+// instead of the bare phase: init progress and failures ("Init:1/3",
+// "Init:CrashLoopBackOff (2/3)"), container waiting/terminated reasons
+// ("CrashLoopBackOff", "OOMKilled", "ExitCode:1") and "Terminating".
+func podStatus(p *corev1.Pod) string {
+	reason := podPhase(p)
+	if p.Status.Reason != "" {
+		reason = p.Status.Reason
+	}
+
+	initializing := false
+	nInit := len(p.Spec.InitContainers)
+	for i, cs := range p.Status.InitContainerStatuses {
+		progress := fmt.Sprintf(" (%d/%d)", i, nInit)
+		switch {
+		case cs.State.Terminated != nil && cs.State.Terminated.ExitCode == 0:
+			continue
+		case cs.State.Terminated != nil:
+			reason = "Init:" + terminatedReason(cs.State.Terminated) + progress
+		case cs.State.Waiting != nil && cs.State.Waiting.Reason != "" &&
+			cs.State.Waiting.Reason != "PodInitializing":
+			reason = "Init:" + cs.State.Waiting.Reason + progress
+		default:
+			reason = fmt.Sprintf("Init:%d/%d", i, nInit)
+		}
+		initializing = true
+		break
+	}
+
+	if !initializing {
+		running := false
+		for i := len(p.Status.ContainerStatuses) - 1; i >= 0; i-- {
+			cs := p.Status.ContainerStatuses[i]
+			switch {
+			case cs.State.Waiting != nil && cs.State.Waiting.Reason != "":
+				reason = cs.State.Waiting.Reason
+			case cs.State.Terminated != nil:
+				reason = terminatedReason(cs.State.Terminated)
+			case cs.Ready && cs.State.Running != nil:
+				running = true
+			}
+		}
+		// a finished sidecar next to running containers is still Running
+		if reason == "Completed" && running {
+			reason = string(corev1.PodRunning)
+		}
+	}
+
+	if p.DeletionTimestamp != nil {
+		if p.Status.Reason == "NodeLost" {
+			return string(corev1.PodUnknown)
+		}
+		return "Terminating"
+	}
+	return reason
+}
+
+func terminatedReason(t *corev1.ContainerStateTerminated) string {
+	switch {
+	case t.Reason != "":
+		return t.Reason
+	case t.Signal != 0:
+		return fmt.Sprintf("Signal:%d", t.Signal)
+	default:
+		return fmt.Sprintf("ExitCode:%d", t.ExitCode)
+	}
+}
@@ -0,0 +1,96 @@
+package ps
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// signalContext is cancelled by SIGINT or SIGTERM, which aborts the
+// API calls in flight.
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// sampleContext bounds one sample by the --timeout deadline, if any.
+func sampleContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(parent, timeout)
+	}
+	return context.WithCancel(parent)
+}
+
+// watchLoop re-runs render every interval until ctx is cancelled by a
+// signal; --timeout applies to each sample rather than to the whole
+// watch. With redraw set, tables replace each other on a terminal like
+// top, and are separated by a blank line when stdout is not one.
+func watchLoop(ctx context.Context, interval, timeout time.Duration, redraw bool, render func(context.Context)) {
+	tty := isTerminal(os.Stdout)
+
+	for first := true; ; first = false {
+		switch {
+		case redraw && tty:
+			fmt.Print("\033[H\033[2J")
+		case redraw && !first:
+			fmt.Println()
+		}
+		sctx, cancel := sampleContext(ctx, timeout)
+		done := make(chan struct{})
+		go func() {
+			render(sctx)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			cancel()
+			return
+		}
+		cancel()
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+type snapshot struct {
+	Timestamp time.Time `json:"timestamp"`
+	Scope     string    `json:"scope"`
+	Rows      []Row     `json:"rows"`
+}
+
+// appendSnapshot writes one sample as a single JSON line. The file is
+// reopened in append mode for every sample, so a log rotated away by
+// logrotate is simply recreated on the next write, and each line goes
+// out in one write call so readers never see a half-written sample.
+func appendSnapshot(path, scope string, rows []Row) error {
+	line, err := json.Marshal(snapshot{
+		Timestamp: time.Now().UTC(),
+		Scope:     scope,
+		Rows:      rows,
+	})
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
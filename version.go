@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time:
+//
+//	go build -ldflags "-X main.version=v0.2.0 -X main.commit=$(git rev-parse --short HEAD)"
+var (
+	version = "dev"
+	commit  = "unknown"
+)
+
+func printVersion(w io.Writer) {
+	v, clientGo := version, "unknown"
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		// go install ...@vX.Y.Z records the module version
+		if v == "dev" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			v = bi.Main.Version
+		}
+		for _, d := range bi.Deps {
+			if d.Path == "k8s.io/client-go" {
+				clientGo = d.Version
+			}
+		}
+	}
+	fmt.Fprintf(w, "kubectl-ps %s (commit %s)\n", v, commit)
+	fmt.Fprintf(w, "client-go  %s\n", clientGo)
+	fmt.Fprintf(w, "go         %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}